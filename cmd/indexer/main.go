@@ -1,11 +1,18 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"libord/config"
+	"libord/internal/follow"
 	"libord/internal/indexer"
+	"libord/internal/migrate"
 	"libord/internal/res"
+	"libord/internal/validator"
 	"libord/pkg/rpc"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -15,6 +22,14 @@ func main() {
 	var endBlock int64
 	var configPath string
 	var chain string
+	var lockWait int
+	var toBlock int64
+	var block int64
+	var revalidate bool
+	var force bool
+	var followTip bool
+	var interval int
+	var migrateChain string
 
 	var cmdRun = &cobra.Command{
 		Use:   "run",
@@ -23,9 +38,12 @@ func main() {
 regardless of whether the inscriptions are valid or not.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			config.Init(configPath)
+			ctx := res.Context()
 			dbConfig := config.Instance().Mysql["app"]
-			_db := res.GetDb(dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
 			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "indexer", lockWait).Release()
 
 			rpcConfig := config.Instance().Rpc[chain]
 			_btc := &rpc.Btc{
@@ -33,10 +51,29 @@ regardless of whether the inscriptions are valid or not.`,
 				Url:      rpcConfig.Url,
 				User:     rpcConfig.User,
 				Password: rpcConfig.Password,
+				Timeout:  time.Duration(rpcConfig.Timeout) * time.Second,
 			}
-			_indexer := &indexer.Indexer{Chain: chain, Db: _db, Rpc: _btc}
-			if _err := _indexer.Run(startBlock, endBlock, config.Instance().MinConfirmation[chain]); _err != nil {
-				log.Fatalf("indexer occur error:%+v", _err)
+			_indexer := &indexer.Indexer{Chain: chain, Db: _db, Ctx: ctx, Rpc: _btc}
+			if !followTip {
+				if _err := _indexer.Run(startBlock, endBlock, config.Instance().MinConfirmation[chain]); _err != nil {
+					log.Fatalf("indexer occur error:%+v", _err)
+				}
+				return
+			}
+			// A signal cancels the block being indexed, and stops the follower.
+			follower := &follow.Follower{
+				Chain:           chain,
+				Indexer:         _indexer,
+				MinConfirmation: config.Instance().MinConfirmation[chain],
+				PollInterval:    time.Duration(interval) * time.Second,
+			}
+			if endpoint := config.Instance().Zmq[chain].HashBlock; endpoint != "" {
+				_zmq := &rpc.Zmq{HashBlockEndpoint: endpoint}
+				follower.Notify = _zmq.Blocks()
+				go _zmq.Run(ctx.Done())
+			}
+			if _err := follower.Run(ctx.Done()); _err != nil {
+				log.Fatalf("follower occur error:%+v", _err)
 			}
 		},
 	}
@@ -45,9 +82,177 @@ regardless of whether the inscriptions are valid or not.`,
 	cmdRun.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
 	cmdRun.Flags().Int64VarP(&startBlock, "start", "s", 0, "start block height")
 	cmdRun.Flags().Int64VarP(&endBlock, "end", "e", 0, "end block height")
+	cmdRun.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running indexer to exit, -1 means forever, e.g: for a standby")
+	cmdRun.Flags().BoolVarP(&followTip, "follow", "f", false, "keep indexing the new blocks as they come, woken up by the zmq block notifications if configured")
+	cmdRun.Flags().IntVarP(&interval, "interval", "i", 10, "seconds to wait before polling the tip of the chain again with --follow")
+
+	var cmdRollback = &cobra.Command{
+		Use:   "rollback",
+		Short: "Undo the blocks after a height",
+		Long: `Delete the txs indexed after the height and undo their validation, e.g: after a reorg, a bad node or a bug fix.
+The balances are unwound by the balance events, or revalidated with --revalidate. Both checkpoints are reset to the height.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "indexer", lockWait).Release()
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
+
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			if _err := _validator.Rollback(toBlock, revalidate); _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+			_indexer := &indexer.Indexer{Chain: chain, Db: _db, Ctx: ctx}
+			if _err := _indexer.Rollback(toBlock); _err != nil {
+				log.Fatalf("indexer occur error:%+v", _err)
+			}
+		},
+	}
+	cmdRollback.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdRollback.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdRollback.Flags().Int64VarP(&toBlock, "to", "t", 0, "the last block height to keep")
+	cmdRollback.Flags().BoolVarP(&revalidate, "revalidate", "r", false, "revalidate the changed ticks instead of unwinding the balances by the balance events")
+	cmdRollback.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running indexer or validator to exit, -1 means forever")
+	cmdRollback.MarkFlagRequired("to")
+
+	var cmdReindex = &cobra.Command{
+		Use:   "reindex",
+		Short: "Index a block again",
+		Long:  "Delete the txs of an indexed but not validated block and index it again, in one transaction.",
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "indexer", lockWait).Release()
+
+			rpcConfig := config.Instance().Rpc[chain]
+			_btc := &rpc.Btc{
+				Chain:    chain,
+				Url:      rpcConfig.Url,
+				User:     rpcConfig.User,
+				Password: rpcConfig.Password,
+				Timeout:  time.Duration(rpcConfig.Timeout) * time.Second,
+			}
+			_indexer := &indexer.Indexer{Chain: chain, Db: _db, Ctx: ctx, Rpc: _btc}
+			if _err := _indexer.Reindex(block); _err != nil {
+				log.Fatalf("indexer occur error:%+v", _err)
+			}
+		},
+	}
+	cmdReindex.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdReindex.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdReindex.Flags().Int64VarP(&block, "block", "b", 0, "block height")
+	cmdReindex.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running indexer to exit, -1 means forever")
+	cmdReindex.MarkFlagRequired("block")
+
+	// migrators: the migrators of the chain, or of every chain in the config if it's empty, with the db of the config.
+	migrators := func() (ret []*migrate.Migrator, _db *sql.DB) {
+		config.Init(configPath)
+		dbConfig := config.Instance().Mysql["app"]
+		_db = res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+		chains := []string{migrateChain}
+		if migrateChain == "" {
+			chains = nil
+			for name := range config.Instance().OrdProtocolName {
+				chains = append(chains, name)
+			}
+			sort.Strings(chains)
+		}
+		for _, name := range chains {
+			ret = append(ret, &migrate.Migrator{Chain: name, Db: _db})
+		}
+		return
+	}
+
+	var cmdMigrate = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the schema",
+		Long:  "Apply or revert the schema migrations built into the binary on the tables of every chain, e.g: btc_ord_tx, ltc_ord_tx and doge_ord_tx.",
+	}
+	cmdMigrate.PersistentFlags().StringVarP(&migrateChain, "chain", "n", "", "chain name,e.g:btc,ltc,doge, every chain in the config if empty")
+	cmdMigrate.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdMigrate.PersistentFlags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for the running indexer and validator to exit, -1 means forever")
+
+	var cmdMigrateUp = &cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations",
+		Run: func(cmd *cobra.Command, args []string) {
+			_migrators, _db := migrators()
+			ctx := res.Context()
+			defer _db.Close()
+			for _, _migrator := range _migrators {
+				lock := res.GetLock(ctx, _db, _migrator.Chain, "indexer", lockWait)
+				validatorLock := res.GetLock(ctx, _db, _migrator.Chain, "validator", lockWait)
+				applied, _err := _migrator.Up()
+				validatorLock.Release()
+				lock.Release()
+				if _err != nil {
+					log.Fatalf("migrate occur error:%+v", _err)
+				}
+				for _, migration := range applied {
+					log.Printf("%s: applied %04d_%s", _migrator.Chain, migration.Version, migration.Name)
+				}
+				log.Printf("%s: the schema is up to date", _migrator.Chain)
+			}
+		},
+	}
+
+	var cmdMigrateDown = &cobra.Command{
+		Use:   "down",
+		Short: "Revert the last applied migration",
+		Run: func(cmd *cobra.Command, args []string) {
+			_migrators, _db := migrators()
+			ctx := res.Context()
+			defer _db.Close()
+			for _, _migrator := range _migrators {
+				lock := res.GetLock(ctx, _db, _migrator.Chain, "indexer", lockWait)
+				validatorLock := res.GetLock(ctx, _db, _migrator.Chain, "validator", lockWait)
+				reverted, _err := _migrator.Down(force)
+				validatorLock.Release()
+				lock.Release()
+				if _err != nil {
+					log.Fatalf("migrate occur error:%+v", _err)
+				}
+				if reverted == nil {
+					log.Printf("%s: no migration applied", _migrator.Chain)
+				} else {
+					log.Printf("%s: reverted %04d_%s", _migrator.Chain, reverted.Version, reverted.Name)
+				}
+			}
+		},
+	}
+
+	var cmdMigrateStatus = &cobra.Command{
+		Use:   "status",
+		Short: "Print the migrations and whether they are applied",
+		Run: func(cmd *cobra.Command, args []string) {
+			_migrators, _db := migrators()
+			defer _db.Close()
+			for _, _migrator := range _migrators {
+				status, _err := _migrator.Status()
+				if _err != nil {
+					log.Fatalf("migrate occur error:%+v", _err)
+				}
+				for _, s := range status {
+					fmt.Printf("%s\t%s\n", _migrator.Chain, s)
+				}
+			}
+		},
+	}
+	cmdMigrateDown.Flags().BoolVar(&force, "force", false, "revert the baseline migration too, which drops all the tables of the chain")
+	cmdMigrate.AddCommand(cmdMigrateUp, cmdMigrateDown, cmdMigrateStatus)
 
 	var rootCmd = &cobra.Command{Use: "ord-indexer"}
 	rootCmd.AddCommand(cmdRun)
+	rootCmd.AddCommand(cmdRollback)
+	rootCmd.AddCommand(cmdReindex)
+	rootCmd.AddCommand(cmdMigrate)
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.Execute()
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"libord/config"
+	"libord/internal/follow"
+	"libord/internal/indexer"
+	"libord/internal/res"
+	"libord/internal/validator"
+	"libord/pkg/rpc"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	var configPath string
+	var chain string
+	var interval int
+	var workers int
+	var checkInvariants bool
+	var lockWait int
+
+	var cmdFollow = &cobra.Command{
+		Use:   "follow",
+		Short: "Index and validate new blocks as they come",
+		Long: `Follow the chain in one long-running process: every confirmed block is indexed and validated straight away.
+SIGINT or SIGTERM stops it after the block being processed is finished, a second one cancels the block at once.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			// The first signal stops the follower after the current block, the second one cancels its queries and rpc calls,
+			// and the default handling of the signals is restored for the third one.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stop := make(chan struct{})
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				sig := <-signals
+				log.Printf("received signal:%s, stopping after the current block", sig)
+				close(stop)
+				sig = <-signals
+				log.Printf("received signal:%s again, cancelling the current block", sig)
+				signal.Stop(signals)
+				cancel()
+			}()
+
+			// The same locks as ord-indexer run and ord-validator run, neither of them may run along with the follower.
+			defer res.GetLock(ctx, _db, chain, "indexer", lockWait).Release()
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
+
+			rpcConfig := config.Instance().Rpc[chain]
+			_btc := &rpc.Btc{
+				Chain:    chain,
+				Url:      rpcConfig.Url,
+				User:     rpcConfig.User,
+				Password: rpcConfig.Password,
+				Timeout:  time.Duration(rpcConfig.Timeout) * time.Second,
+			}
+
+			follower := &follow.Follower{
+				Chain:           chain,
+				Indexer:         &indexer.Indexer{Chain: chain, Db: _db, Rpc: _btc, Ctx: ctx},
+				Validator:       &validator.Validator{Chain: chain, Db: _db, Ctx: ctx, CheckInvariants: checkInvariants, Workers: workers},
+				MinConfirmation: config.Instance().MinConfirmation[chain],
+				PollInterval:    time.Duration(interval) * time.Second,
+			}
+			// The block notifications only shorten the wait, the follower keeps polling if the node can't be subscribed.
+			if endpoint := config.Instance().Zmq[chain].HashBlock; endpoint != "" {
+				_zmq := &rpc.Zmq{HashBlockEndpoint: endpoint}
+				follower.Notify = _zmq.Blocks()
+				go _zmq.Run(stop)
+			}
+			if _err := follower.Run(stop); _err != nil {
+				log.Fatalf("follower occur error:%+v", _err)
+			}
+		},
+	}
+	cmdFollow.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdFollow.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdFollow.Flags().IntVarP(&interval, "interval", "i", 10, "seconds to wait before polling the tip of the chain again")
+	cmdFollow.Flags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "number of ticks validated concurrently, 1 means one by one")
+	cmdFollow.Flags().BoolVarP(&checkInvariants, "check", "k", false, "check the invariants after every block and stop if any is broken")
+	cmdFollow.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running indexer or validator to exit, -1 means forever, e.g: for a standby")
+
+	var rootCmd = &cobra.Command{Use: "ord"}
+	rootCmd.AddCommand(cmdFollow)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.Execute()
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"fmt"
 	"libord/config"
+	"libord/internal/indexer"
+	"libord/internal/models"
 	"libord/internal/res"
 	"libord/internal/validator"
+	"libord/pkg/conv"
+	"libord/pkg/rpc"
 	"log"
+	"os"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -16,6 +24,21 @@ func main() {
 	var ticks string
 	var startBlock int64
 	var endBlock int64
+	var block int64
+	var expectHash string
+	var tick string
+	var address string
+	var checkInvariants bool
+	var diffOnly bool
+	var workers int
+	var txid string
+	var op string
+	var inputIndex int
+	var status string
+	var amount string
+	var reason string
+	var author string
+	var lockWait int
 
 	var cmdRun = &cobra.Command{
 		Use:   "run",
@@ -24,11 +47,14 @@ func main() {
 Some inscriptions may exhibit double-spending or insufficient balance issues.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			config.Init(configPath)
+			ctx := res.Context()
 			dbConfig := config.Instance().Mysql["app"]
-			_db := res.GetDb(dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
 			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
 
-			_validator := &validator.Validator{Chain: chain, Db: _db}
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx, CheckInvariants: checkInvariants, Workers: workers}
 			if _err := _validator.Run(); _err != nil {
 				log.Fatalf("validator occur error:%+v", _err)
 			}
@@ -37,32 +63,332 @@ Some inscriptions may exhibit double-spending or insufficient balance issues.`,
 
 	cmdRun.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
 	cmdRun.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdRun.Flags().BoolVarP(&checkInvariants, "check", "k", false, "check the invariants after every block and stop if any is broken")
+	cmdRun.Flags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "number of ticks validated concurrently, 1 means one by one")
+	cmdRun.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running validator to exit, -1 means forever, e.g: for a standby")
 
 	var cmdRevalidate = &cobra.Command{
 		Use:   "revalidate",
 		Short: "Revalidate all inscriptions",
-		Long:  "Revalidate all inscription records in the database table from beginning.",
+		Long: `Revalidate all inscription records of the ticks from beginning.
+The ticks are recalculated in shadow tables and swapped into the live tables in one transaction after the invariant check passes.
+The progress is saved after every block, running the same command again resumes an interrupted revalidation.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			config.Init(configPath)
+			ctx := res.Context()
 			dbConfig := config.Instance().Mysql["app"]
-			_db := res.GetDb(dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
 			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
 
-			_validator := &validator.Validator{Chain: chain, Db: _db}
-			if _err := _validator.Revalidate(startBlock, endBlock, strings.Split(ticks, ",")); _err != nil {
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx, Workers: workers}
+			if changes, _err := _validator.Revalidate(startBlock, endBlock, strings.Split(ticks, ","), diffOnly); _err != nil {
 				log.Fatalf("validator occur error:%+v", _err)
+			} else if diffOnly {
+				for _, change := range changes {
+					fmt.Println(change)
+				}
 			}
 		},
 	}
 	cmdRevalidate.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
 	cmdRevalidate.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
 	cmdRevalidate.Flags().StringVarP(&ticks, "ticks", "t", "", "List of ticks that need to be revalidated, separated by commas.")
-	cmdRevalidate.Flags().Int64VarP(&startBlock, "start", "s", 0, "start block height")
-	cmdRevalidate.Flags().Int64VarP(&endBlock, "end", "e", 0, "end block height")
+	cmdRevalidate.Flags().Int64VarP(&startBlock, "start", "s", 0, "start block height, defaults to the block before the earliest deploy of the ticks")
+	cmdRevalidate.Flags().Int64VarP(&endBlock, "end", "e", 0, "end block height, defaults to the latest validated block")
+	cmdRevalidate.Flags().BoolVarP(&diffOnly, "diff", "d", false, "print the changes only, keep the live tables as they are")
+	cmdRevalidate.Flags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "number of ticks validated concurrently, 1 means one by one")
+	cmdRevalidate.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running validator to exit, -1 means forever, e.g: for a standby")
+
+	var cmdHash = &cobra.Command{
+		Use:   "hash",
+		Short: "Print or compare the state hash of a block",
+		Long: `Print the state commitment hash of a validated block, which chains the balance and tick changes of all blocks before it.
+Two validators agree on the whole state up to the block if they print the same hash.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			hash, _err := _validator.BlockHash(block)
+			if _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+			if hash == "" {
+				log.Fatalf("no hash found at block:%d", block)
+			}
+			fmt.Println(hash)
+			if expectHash != "" && !strings.EqualFold(expectHash, hash) {
+				log.Fatalf("hash mismatch, expect:%s got:%s", expectHash, hash)
+			}
+		},
+	}
+	cmdHash.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdHash.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdHash.Flags().Int64VarP(&block, "block", "b", 0, "block height, default is the latest validated block")
+	cmdHash.Flags().StringVarP(&expectHash, "expect", "x", "", "exit with error if the hash is not equal to this one")
+
+	var cmdBalance = &cobra.Command{
+		Use:   "balance",
+		Short: "Print the balances of a tick at a block height",
+		Long: `Print the balances of all holders of a tick, or of one address if --address is specified, at a validated block height.
+The balances are rebuilt from the balance snapshots and the balance events, e.g. for an airdrop snapshot.
+Output is csv: address,available,transferable`,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			var holders []*models.Address
+			if address != "" {
+				holder, _err := _validator.BalanceAt(block, tick, address)
+				if _err != nil {
+					log.Fatalf("validator occur error:%+v", _err)
+				}
+				holders = append(holders, holder)
+			} else {
+				var _err error
+				if holders, _err = _validator.HoldersAt(block, tick); _err != nil {
+					log.Fatalf("validator occur error:%+v", _err)
+				}
+			}
+			for _, holder := range holders {
+				fmt.Printf("%s,%s,%s\n", holder.Address, conv.Decimal(holder.Available).String(), conv.Decimal(holder.Transferable).String())
+			}
+		},
+	}
+	cmdBalance.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdBalance.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdBalance.Flags().StringVarP(&tick, "tick", "t", "", "tick name")
+	cmdBalance.Flags().StringVarP(&address, "address", "a", "", "address, default is all holders of the tick")
+	cmdBalance.Flags().Int64VarP(&block, "block", "b", 0, "block height")
+	cmdBalance.MarkFlagRequired("tick")
+	cmdBalance.MarkFlagRequired("block")
+
+	var cmdCheck = &cobra.Command{
+		Use:   "check",
+		Short: "Check the invariants of the validated state",
+		Long: `Check that the sum of available and transferable balances of every tick equals its minted amount,
+no balance is negative and no minted amount exceeds the supply. Every broken invariant is printed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			var tickList []string
+			if ticks != "" {
+				tickList = strings.Split(ticks, ",")
+			}
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			violations, _err := _validator.Check(tickList)
+			if _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+			for _, violation := range violations {
+				fmt.Println(violation)
+			}
+			if len(violations) > 0 {
+				log.Fatalf("%d invariants broken", len(violations))
+			}
+		},
+	}
+	cmdCheck.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdCheck.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmdCheck.Flags().StringVarP(&ticks, "ticks", "t", "", "List of ticks to check, separated by commas, default is all ticks.")
+
+	var cmdExplain = &cobra.Command{
+		Use:   "explain TXID",
+		Short: "Explain why a tx is valid or invalid",
+		Long: `Print the decoded envelope of the tx, its indexed rows, the sat path of the transfers, the balances just before
+the tx and the validation rules it passed or failed with the values compared. The envelope and the sat path need the rpc.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			rpcConfig := config.Instance().Rpc[chain]
+			_indexer := &indexer.Indexer{Chain: chain, Db: _db, Ctx: ctx, Rpc: &rpc.Btc{Chain: chain, Url: rpcConfig.Url, User: rpcConfig.User, Password: rpcConfig.Password, Timeout: time.Duration(rpcConfig.Timeout) * time.Second}}
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			txid := args[0]
+			explanations, _err := _validator.Explain(txid)
+			if _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+
+			fmt.Println("envelopes:")
+			if envelopes, _err := _indexer.Envelopes(txid); _err != nil {
+				fmt.Printf("  [WARN] decode envelopes error:%+v\n", _err)
+			} else {
+				for _, envelope := range envelopes {
+					fmt.Printf("  input:%d content-type:%s content:%s\n", envelope.InputIndex, envelope.Meta, envelope.Content)
+				}
+			}
+			for _, explanation := range explanations {
+				tx := explanation.Tx
+				fmt.Printf("\nop:%s input:%d tick:%s block:%d pos:%d\n", tx.Operation, tx.InputIndex, tx.Tick, tx.BlockHeight, tx.Position)
+				fmt.Printf("  row: id:%d from:%s to:%s amt:%s sat_offset:%s output:%d status:%d valid_amt:%s reason:%s\n", tx.Id, tx.From, tx.To, tx.Amount, tx.SatOffset, tx.OutputIndex, tx.Status, tx.ValidAmount, tx.Reason)
+				if explanation.Patch != nil {
+					fmt.Printf("  patched by %s: status:%d valid_amt:%s reason:%s\n", explanation.Patch.Author, explanation.Patch.Status, explanation.Patch.ValidAmount, explanation.Patch.Reason)
+				}
+				if strings.EqualFold(tx.Operation, "transfer") {
+					if path, _err := _indexer.SatPath(tx); _err != nil {
+						fmt.Printf("  [WARN] trace sat path error:%+v\n", _err)
+					} else {
+						fmt.Printf("  sat path: offset %s of the spent output => %d,%d of all inputs (input total:%d output total:%d fee:%d)\n", path.PrevSatOffset, path.InputOffset, path.InputEnd, path.InputTotal, path.OutputTotal, path.Fee)
+						for idx, output := range path.Outputs {
+							mark := ""
+							if idx == path.OutputIndex {
+								mark = " <= " + path.SatOffset
+							}
+							if output.IsFee {
+								mark += " (fee)"
+							}
+							fmt.Printf("    output:%d offset:%d value:%d address:%s%s\n", idx, output.Offset, output.Value, output.Address, mark)
+						}
+					}
+				}
+				if !explanation.Validated {
+					fmt.Println("  not validated yet, the latest balances are used")
+				}
+				if explanation.Tick != nil {
+					fmt.Printf("  tick before: supply:%s lim:%s minted:%s deploy:%s\n", explanation.Tick.Supply, explanation.Tick.MintLimit, conv.Decimal(explanation.Tick.MintedAmount).String(), explanation.Tick.DeployTx)
+				}
+				for _, balance := range explanation.Balances {
+					fmt.Printf("  balance before: %s available:%s transferable:%s\n", balance.Address, conv.Decimal(balance.Available).String(), conv.Decimal(balance.Transferable).String())
+				}
+				for _, rule := range explanation.Rules {
+					fmt.Printf("  %s\n", rule)
+				}
+			}
+		},
+	}
+	cmdExplain.Flags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdExplain.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+
+	var cmdPatch = &cobra.Command{
+		Use:   "patch",
+		Short: "Manage the manual patches of txs",
+		Long: `A patch forces the status and valid amount of a tx whatever the rules say, it's kept in the ord_patch table
+and survives revalidation. Adding or removing a patch of a validated tx revalidates its tick.`,
+	}
+	cmdPatch.PersistentFlags().StringVarP(&chain, "chain", "n", "btc", "chain name,e.g:btc,ltc,doge")
+	cmdPatch.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path")
+
+	var cmdPatchAdd = &cobra.Command{
+		Use:   "add",
+		Short: "Patch a tx",
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
+
+			patch := &models.Patch{TxId: txid, Operation: op, InputIndex: inputIndex, ValidAmount: amount, Reason: reason, Author: author}
+			switch strings.ToLower(status) {
+			case "valid":
+				patch.Status = models.TxStatusValid
+			case "invalid":
+				patch.Status = models.TxStatusInvalid
+			default:
+				log.Fatalf("status:%s not valid, should be valid or invalid", status)
+			}
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			if _err := _validator.AddPatch(patch); _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+		},
+	}
+	cmdPatchAdd.Flags().StringVarP(&txid, "txid", "i", "", "txid")
+	cmdPatchAdd.Flags().StringVarP(&op, "op", "o", "", "op of the tx, needed if the tx has several ops at the input")
+	cmdPatchAdd.Flags().IntVarP(&inputIndex, "input-index", "x", 0, "input index of the tx")
+	cmdPatchAdd.Flags().StringVarP(&status, "status", "s", "", "the forced status: valid or invalid")
+	cmdPatchAdd.Flags().StringVarP(&amount, "amount", "m", "", "the forced valid amount, default is the amount of the tx")
+	cmdPatchAdd.Flags().StringVarP(&reason, "reason", "r", "", "why the tx is patched")
+	cmdPatchAdd.Flags().StringVarP(&author, "by", "b", os.Getenv("USER"), "who patches the tx")
+	cmdPatchAdd.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running validator to exit, -1 means forever, e.g: for a standby")
+	cmdPatchAdd.MarkFlagRequired("txid")
+	cmdPatchAdd.MarkFlagRequired("status")
+	cmdPatchAdd.MarkFlagRequired("reason")
+
+	var cmdPatchList = &cobra.Command{
+		Use:   "list",
+		Short: "List the patches",
+		Long:  "List the patches, output is csv: txid,op,input_idx,tick,block,status,valid_amt,author,create_time,reason",
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			patches, _err := _validator.Patches(tick)
+			if _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+			for _, patch := range patches {
+				fmt.Printf("%s,%s,%d,%s,%d,%d,%s,%s,%d,%s\n", patch.TxId, patch.Operation, patch.InputIndex, patch.Tick, patch.Block, patch.Status, patch.ValidAmount, patch.Author, patch.CreateTime, patch.Reason)
+			}
+		},
+	}
+	cmdPatchList.Flags().StringVarP(&tick, "tick", "t", "", "tick name, default is all ticks")
+
+	var cmdPatchRemove = &cobra.Command{
+		Use:   "remove",
+		Short: "Remove the patch of a tx",
+		Run: func(cmd *cobra.Command, args []string) {
+			config.Init(configPath)
+			ctx := res.Context()
+			dbConfig := config.Instance().Mysql["app"]
+			_db := res.GetDb(dbConfig.Driver, dbConfig.Host, dbConfig.Db, dbConfig.User, dbConfig.Password)
+			defer _db.Close()
+			res.CheckSchema(_db, chain)
+			defer res.GetLock(ctx, _db, chain, "validator", lockWait).Release()
+
+			_validator := &validator.Validator{Chain: chain, Db: _db, Ctx: ctx}
+			if _err := _validator.RemovePatch(txid, op, inputIndex); _err != nil {
+				log.Fatalf("validator occur error:%+v", _err)
+			}
+		},
+	}
+	cmdPatchRemove.Flags().StringVarP(&txid, "txid", "i", "", "txid")
+	cmdPatchRemove.Flags().StringVarP(&op, "op", "o", "", "op of the tx, needed if the tx has several patches at the input")
+	cmdPatchRemove.Flags().IntVarP(&inputIndex, "input-index", "x", 0, "input index of the tx")
+	cmdPatchRemove.Flags().IntVar(&lockWait, "lock-wait", 0, "seconds to wait for another running validator to exit, -1 means forever, e.g: for a standby")
+	cmdPatchRemove.MarkFlagRequired("txid")
+
+	cmdPatch.AddCommand(cmdPatchAdd)
+	cmdPatch.AddCommand(cmdPatchList)
+	cmdPatch.AddCommand(cmdPatchRemove)
 
 	var rootCmd = &cobra.Command{Use: "ord-validator"}
 	rootCmd.AddCommand(cmdRun)
 	rootCmd.AddCommand(cmdRevalidate)
+	rootCmd.AddCommand(cmdHash)
+	rootCmd.AddCommand(cmdBalance)
+	rootCmd.AddCommand(cmdCheck)
+	rootCmd.AddCommand(cmdExplain)
+	rootCmd.AddCommand(cmdPatch)
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.Execute()
 }
@@ -5,12 +5,17 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
 
 type Config struct {
+	Db struct {
+		Timeout int // seconds of a statement, a bulk update, or an Each with its callbacks, no timeout if 0
+	}
 	Mysql map[string]struct {
+		Driver   string // mysql, postgres or sqlite, default is mysql
 		Host     string
 		Db       string
 		User     string
@@ -20,10 +25,16 @@ type Config struct {
 		Url      string
 		User     string
 		Password string
+		Timeout  int // seconds of a try of a call, a minute if 0
+	}
+	MinConfirmation  map[string]int
+	OrdGenesisBlock  map[string]int64
+	OrdProtocolName  map[string]string
+	SnapshotInterval map[string]int64 // take a balance snapshot every n blocks, 0 means never
+	StateCacheSize   map[string]int   // max number of address balances kept in memory by the validator
+	Zmq              map[string]struct {
+		HashBlock string // zmqpubhashblock endpoint of the node, empty means polling only
 	}
-	MinConfirmation map[string]int
-	OrdGenesisBlock map[string]int64
-	OrdProtocolName map[string]string
 }
 
 var _config = &Config{}
@@ -48,3 +59,8 @@ func Init(configPath string) {
 func Instance() *Config {
 	return _config
 }
+
+// DbTimeout: the timeout of the database calls of the indexer and the validator, 0 means no timeout.
+func (c *Config) DbTimeout() time.Duration {
+	return time.Duration(c.Db.Timeout) * time.Second
+}
@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// Engine applies the [x]rc-20 rules on the txs of blocks. It doesn't know where the balances are stored,
+// all reads and writes go through State.
+type Engine struct {
+	Protocol string // protocol name, e.g: brc-20
+	State    State
+	Workers  int // number of ticks applied concurrently, the txs are applied one by one if <= 1
+}
+
+// ApplyBlock validates the txs of a block, which must be ordered by position and input index, and changes the state.
+// The status, reason and valid amount of the txs are set in place.
+// Balances of different ticks never interact, so the txs of every tick are applied concurrently if Workers > 1,
+// except the ticks linked by a transfer, the result is exactly the same as applying them one by one.
+func (e *Engine) ApplyBlock(block int64, txs []*models.Tx) (result *Result, err error) {
+	seqs := make([]int, len(txs))
+	for i := range txs {
+		seqs[i] = i
+	}
+	if e.Workers <= 1 {
+		result = newResult(block)
+		if err = e.applyTxs(block, txs, seqs, result); err != nil {
+			return
+		}
+	} else {
+		// A transfer takes the status of the first former tx of its inscribe tx in the block whatever its tick is,
+		// so the ticks linked by such a transfer are applied in the same group.
+		parent := make(map[string]string)
+		var find func(key string) string
+		find = func(key string) string {
+			if parent[key] != key {
+				parent[key] = find(parent[key])
+			}
+			return parent[key]
+		}
+		firstTicks := make(map[string]string) // the tick of the first tx, by txid
+		for _, tx := range txs {
+			key := strings.ToLower(tx.Tick)
+			if _, ok := parent[key]; !ok {
+				parent[key] = key
+			}
+			if strings.EqualFold(tx.Operation, "transfer") && len(tx.InscriptionId) >= 64 {
+				if tick, ok := firstTicks[tx.InscriptionId[0:64]]; ok {
+					parent[find(tick)] = find(key)
+				}
+			}
+			if _, ok := firstTicks[tx.TxId]; !ok {
+				firstTicks[tx.TxId] = key
+			}
+		}
+		groupIdx := make(map[string]int)
+		var groups [][]int
+		for i, tx := range txs {
+			key := find(strings.ToLower(tx.Tick))
+			if _, ok := groupIdx[key]; !ok {
+				groupIdx[key] = len(groups)
+				groups = append(groups, nil)
+			}
+			groups[groupIdx[key]] = append(groups[groupIdx[key]], i)
+		}
+
+		parts := make([]*Result, len(groups))
+		errs := make([]error, len(groups))
+		sem := make(chan struct{}, e.Workers)
+		var wg sync.WaitGroup
+		for i, group := range groups {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, group []int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				var groupTxs []*models.Tx
+				for _, idx := range group {
+					groupTxs = append(groupTxs, txs[idx])
+				}
+				parts[i] = newResult(block)
+				errs[i] = e.applyTxs(block, groupTxs, group, parts[i])
+			}(i, group)
+		}
+		wg.Wait()
+		for _, _err := range errs {
+			if _err != nil {
+				err = _err
+				return
+			}
+		}
+		result = mergeResults(block, txs, parts)
+	}
+
+	for _, tick := range result.Ticks {
+		if tick.BlockAtUpdate < block {
+			tick.BlockAtUpdate = block
+		}
+	}
+	for _, address := range result.Addresses {
+		if address.BlockAtUpdate < block {
+			address.BlockAtUpdate = block
+		}
+	}
+	return
+}
+
+// applyTxs: apply the txs in order, seqs are the indexes of the txs in the block.
+func (e *Engine) applyTxs(block int64, txs []*models.Tx, seqs []int, result *Result) (err error) {
+	// Because we batch update all transactions under a block, we need to cache these transactions.
+	// This ensures that 'transfer' transactions can obtain the correct 'inscribe-transfer' status before the database is updated.
+	txMap := make(map[string][]*models.Tx)
+
+	for i, tx := range txs {
+		result.seq = seqs[i]
+		// The status of a manual patch is forced, the rules are not checked against it.
+		if isPatch := strings.Index(tx.Reason, "patch:") == 0; isPatch {
+			result.Patches = append(result.Patches, tx)
+			if tx.Status == models.TxStatusValid {
+				status, reason, validAmount := tx.Status, tx.Reason, tx.ValidAmount
+				if err = e.applyTx(block, tx, isPatch, txMap, result); err != nil {
+					return
+				}
+				tx.Status, tx.Reason, tx.ValidAmount = status, reason, validAmount
+			}
+		} else {
+			if err = e.applyTx(block, tx, isPatch, txMap, result); err != nil {
+				return
+			}
+			if tx.Reason != "" {
+				tx.Status = models.TxStatusInvalid
+			} else {
+				tx.Status = models.TxStatusValid
+			}
+			result.Txs = append(result.Txs, tx)
+		}
+		txMap[tx.TxId] = append(txMap[tx.TxId], tx)
+	}
+	return
+}
+
+func (e *Engine) applyTx(block int64, tx *models.Tx, isPatch bool, txMap map[string][]*models.Tx, result *Result) (err error) {
+	var tick *models.Tick
+	if tick, err = e.State.Tick(tx.Tick); err != nil {
+		return
+	}
+	if tx.Reason = e.validateTick(tx, tick, nil); tx.Reason != "" {
+		return
+	}
+
+	// ensure address has balance records
+	var sender, recipient *models.Address
+	if tx.From != "" {
+		if sender, err = e.State.Address(tick.Name, tx.From); err != nil {
+			return
+		}
+	}
+	if tx.To != "" {
+		if recipient, err = e.State.Address(tick.Name, tx.To); err != nil {
+			return
+		}
+	}
+	result.touch(tick, sender, recipient)
+
+	if tx.Reason = e.validateCommon(tx, nil); tx.Reason != "" {
+		return
+	}
+	// The txs patched valid are applied whatever the rules of the op say.
+	if tx.Reason, err = e.validateOp(tx, tick, sender, recipient, txMap, nil); err != nil || (tx.Reason != "" && !isPatch) {
+		return
+	}
+	amount := conv.Decimal(tx.Amount)
+	if isPatch && tx.ValidAmount != "" { // the amount forced by the patch
+		amount = conv.Decimal(tx.ValidAmount)
+	}
+	switch strings.ToLower(tx.Operation) {
+	case "mint":
+		remainMintAmount := conv.Decimal(tick.Supply).Sub(conv.Decimal(tick.MintedAmount))
+		if remainMintAmount.LessThanOrEqual(amount) { // remain mint amount <= tx amount
+			if tick.BlockAtUpdate < block {
+				tx.ValidAmount = remainMintAmount.String()
+				tick.MintedAmount = tick.Supply
+				tick.FinishMintTx = tx.TxId
+				tick.FinishMintTime = tx.BlockTime
+				result.markTick(tick)
+			}
+
+			if recipient.BlockAtUpdate < block {
+				recipient.Available = conv.Decimal(recipient.Available).Add(remainMintAmount).String()
+				result.journal(tx, recipient, remainMintAmount, decimal.Zero)
+			}
+		} else { // remain mint amount is sufficient
+			if tick.BlockAtUpdate < block {
+				tick.MintedAmount = conv.Decimal(tick.MintedAmount).Add(amount).String()
+				result.markTick(tick)
+			}
+
+			if recipient.BlockAtUpdate < block {
+				recipient.Available = conv.Decimal(recipient.Available).Add(amount).String()
+				result.journal(tx, recipient, amount, decimal.Zero)
+			}
+		}
+	case "inscribe-transfer":
+		if recipient.BlockAtUpdate < block {
+			recipient.Available = conv.Decimal(recipient.Available).Sub(amount).String()
+			recipient.Transferable = conv.Decimal(recipient.Transferable).Add(amount).String()
+			result.journal(tx, recipient, amount.Neg(), amount)
+		}
+	case "transfer":
+		// Do not revalidate addresses that have been verified before to avoid discrepancies caused by duplicate changes in amounts.
+		// Validation must occur incrementally for each block; it cannot be done intermittently.
+		// Otherwise, transactions that were verified later may be invalid, requiring revalidation.
+		if sender.BlockAtUpdate < block {
+			// Deduct transferable-amount from the sender.
+			sender.Transferable = conv.Decimal(sender.Transferable).Sub(amount).String()
+			result.journal(tx, sender, decimal.Zero, amount.Neg())
+		}
+		if sender.BlockAtUpdate < block {
+			// Credit available-amount to the recipient.
+			recipient.Available = conv.Decimal(recipient.Available).Add(amount).String()
+			result.journal(tx, recipient, amount, decimal.Zero)
+		}
+	}
+	return
+}
+
+// recorder records the rules checked on a tx for Explain, the validation of ApplyBlock passes a nil one which records nothing.
+type recorder struct {
+	rules []*Rule
+}
+
+// check: record the rule if r is not nil, the detail is only formatted then. It returns passed.
+func (r *recorder) check(name string, passed bool, format string, args ...any) bool {
+	if r != nil {
+		r.rules = append(r.rules, &Rule{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+	return passed
+}
+
+func (e *Engine) validateTick(tx *models.Tx, tick *models.Tick, r *recorder) string {
+	if !r.check("tick deployed", tick != nil, "tick:%s", tx.Tick) {
+		return fmt.Sprintf("The tick:%s has not been deployed yet.", tx.Tick)
+	}
+	return ""
+}
+
+func (e *Engine) validateCommon(tx *models.Tx, r *recorder) string {
+	if !r.check("address", tx.From != "" || tx.To != "", "from:%q to:%q", tx.From, tx.To) {
+		return "'from' and 'to' address are both empty"
+	}
+
+	if !strings.EqualFold(tx.Operation, "transfer") {
+		if m := conv.Map(tx.Content); m != nil {
+			if p := conv.String(m["p"]); !r.check("protocol", strings.EqualFold(p, e.Protocol), "p:%s expect:%s", p, e.Protocol) {
+				return "not " + e.Protocol + " protocol"
+			}
+		}
+		contentType := strings.ToLower(strings.TrimSpace(tx.Meta))
+		if !r.check("content type", strings.Index(contentType, "text/plain") == 0 || strings.Index(contentType, "application/json") == 0, "%s, expect text/plain or application/json", tx.Meta) {
+			return fmt.Sprintf("content-type:%s is not valid", tx.Meta)
+		}
+	}
+
+	if !strings.EqualFold(tx.Operation, "deploy") && !r.check("amount", conv.Decimal(tx.Amount).GreaterThan(decimal.Zero), "%s > 0", tx.Amount) {
+		return fmt.Sprintf("The amount:%s not valid", tx.Amount)
+	}
+	return ""
+}
+
+// validateOp: check the rules of the op of the tx, which passed validateTick and validateCommon.
+func (e *Engine) validateOp(tx *models.Tx, tick *models.Tick, sender, recipient *models.Address, txMap map[string][]*models.Tx, r *recorder) (reason string, err error) {
+	switch strings.ToLower(tx.Operation) {
+	case "deploy": // No need to validate name, dec, max, lim; it seems redundant, so ignore them.
+		if !r.check("first deploy", tick.DeployTx == tx.TxId, "deploy tx of tick:%s is %s", tick.Name, tick.DeployTx) {
+			reason = fmt.Sprintf("The tick:%s has been deployed at %s.", tx.Tick, tick.DeployTx)
+		}
+	case "mint":
+		reason = e.validateMint(tx, tick, r)
+	case "inscribe-transfer":
+		reason = e.validateInscribeTransfer(tx, recipient, r)
+	case "transfer":
+		reason, err = e.validateTransfer(tx, sender, txMap, r)
+	default:
+		r.check("op", false, "unknown op:%s", tx.Operation)
+		reason = fmt.Sprintf("unknown op:%s", tx.Operation)
+	}
+	return
+}
+
+func (e *Engine) validateMint(tx *models.Tx, tick *models.Tick, r *recorder) string {
+	amount := conv.Decimal(tx.Amount)
+	if !r.check("deployed before", !(tick.DeployTime > tx.BlockTime || (tick.DeployTime == tx.BlockTime && tick.DeployPosition > tx.Position)),
+		"deploy time:%d pos:%d, mint time:%d pos:%d", tick.DeployTime, tick.DeployPosition, tx.BlockTime, tx.Position) {
+		return fmt.Sprintf("The tick:%s has not been deployed before %d.", tx.Tick, tx.BlockTime)
+	} else if !r.check("mint limit", amount.LessThanOrEqual(conv.Decimal(tick.MintLimit)), "%s <= %s", tx.Amount, tick.MintLimit) {
+		return fmt.Sprintf("The mint amount:%s has exceeded mint limit:%s", tx.Amount, tick.MintLimit)
+	}
+	remainMintAmount := conv.Decimal(tick.Supply).Sub(conv.Decimal(tick.MintedAmount))
+	if !r.check("remaining supply", remainMintAmount.GreaterThan(decimal.Zero), "supply:%s - minted:%s = %s > 0", tick.Supply, conv.Decimal(tick.MintedAmount), remainMintAmount) {
+		return fmt.Sprintf("The tick:%s have already been full minted.", tick.Name)
+	}
+	if remainMintAmount.LessThanOrEqual(amount) {
+		r.check("last mint", true, "only the remaining %s is minted", remainMintAmount)
+	}
+	return ""
+}
+
+func (e *Engine) validateInscribeTransfer(tx *models.Tx, address *models.Address, r *recorder) string {
+	amount := conv.Decimal(tx.Amount)
+	if !r.check("available balance", conv.Decimal(address.Available).GreaterThanOrEqual(amount), "%s available of %s >= %s", conv.Decimal(address.Available), address.Address, tx.Amount) {
+		return fmt.Sprintf("Insufficient balance for inscription; 'available balance' is only '%s'", address.Available)
+	}
+	return ""
+}
+
+func (e *Engine) validateTransfer(tx *models.Tx, address *models.Address, txMap map[string][]*models.Tx, r *recorder) (reason string, err error) {
+	amount := conv.Decimal(tx.Amount)
+	if !r.check("sender", address != nil, "from:%q", tx.From) {
+		reason = "The inscribe-transfer tx has no recipient."
+		return
+	}
+	if !r.check("transferable balance", conv.Decimal(address.Transferable).GreaterThanOrEqual(amount), "%s transferable of %s >= %s", conv.Decimal(address.Transferable), address.Address, tx.Amount) {
+		reason = fmt.Sprintf("Insufficient balance for inscription; 'transferable balance' is only '%s'", address.Transferable)
+		return
+	}
+	inscribeTx := tx.InscriptionId[0:64]
+	if len(txMap[inscribeTx]) > 0 && txMap[inscribeTx][0].Status == models.TxStatusValid {
+		r.check("inscribe-transfer valid", true, "inscribe-transfer tx:%s in the same block", inscribeTx)
+		return
+	}
+	var valid bool
+	if valid, err = e.State.ValidInscribeTransfer(inscribeTx, tx.Tick); err != nil {
+		return
+	} else if !r.check("inscribe-transfer valid", valid, "inscribe-transfer tx:%s", inscribeTx) {
+		reason = fmt.Sprintf("The previous inscribe-transfer tx:%s failed.", tx.InscriptionId)
+	}
+	return
+}
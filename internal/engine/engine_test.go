@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTx(txid, op, from, to, amount string, pos int) *models.Tx {
+	return &models.Tx{
+		TxId:          txid,
+		InscriptionId: txid + "i0",
+		Operation:     op,
+		Tick:          "ordi",
+		Amount:        amount,
+		From:          from,
+		To:            to,
+		BlockHeight:   800000,
+		BlockTime:     1690000000,
+		Position:      pos,
+		Meta:          "text/plain;charset=utf-8",
+		Content:       `{"p":"brc-20","op":"` + op + `","tick":"ordi","amt":"` + amount + `"}`,
+	}
+}
+
+func Test_ApplyBlock(t *testing.T) {
+	tick := &models.Tick{Name: "ordi", Supply: "1000", MintLimit: "600", MintedAmount: "0", DeployTx: "deploy", DeployTime: 1680000000}
+	state := NewMemoryState(tick)
+	e := &Engine{Protocol: "brc-20", State: state}
+
+	inscribeId := strings.Repeat("a", 64)
+	mint := newTx("mint1", "mint", "", "bc1qa", "600", 1)
+	overLimit := newTx("mint2", "mint", "", "bc1qa", "700", 2)
+	capped := newTx("mint3", "mint", "", "bc1qb", "600", 3)
+	insufficient := newTx("inscribe1", "inscribe-transfer", "", "bc1qa", "601", 4)
+	inscribe := newTx(inscribeId, "inscribe-transfer", "", "bc1qa", "100", 5)
+	transfer := newTx(inscribeId, "transfer", "bc1qa", "bc1qc", "100", 6)
+	transfer.InscriptionId = inscribeId + "i0"
+	result, err := e.ApplyBlock(800000, []*models.Tx{mint, overLimit, capped, insufficient, inscribe, transfer})
+	assert.Nil(t, err)
+	assert.Nil(t, state.Commit(result))
+
+	assert.Equal(t, models.TxStatusValid, mint.Status)
+	assert.Equal(t, models.TxStatusInvalid, overLimit.Status)
+	assert.Equal(t, models.TxStatusValid, capped.Status)
+	assert.Equal(t, "400", capped.ValidAmount)
+	assert.Equal(t, models.TxStatusInvalid, insufficient.Status)
+	assert.Equal(t, models.TxStatusValid, inscribe.Status)
+	assert.Equal(t, models.TxStatusValid, transfer.Status)
+	assert.Len(t, result.Txs, 6)
+	assert.Len(t, result.Check(), 0)
+
+	assert.Equal(t, "1000", tick.MintedAmount)
+	assert.Equal(t, "mint3", tick.FinishMintTx)
+	a, _ := state.Address("ordi", "bc1qa")
+	assert.Equal(t, "500", a.Available)
+	assert.Equal(t, "0", a.Transferable)
+	c, _ := state.Address("ordi", "bc1qc")
+	assert.Equal(t, "100", c.Available)
+	assert.Equal(t, int64(800000), c.BlockAtUpdate)
+
+	// The tick is fully minted and the transfer has no valid inscribe-transfer in the state.
+	e2 := &Engine{Protocol: "brc-20", State: state}
+	full := newTx("mint4", "mint", "", "bc1qa", "1", 1)
+	orphan := newTx(strings.Repeat("b", 64), "transfer", "bc1qa", "bc1qc", "1", 2)
+	undeployed := newTx("mint5", "mint", "", "bc1qa", "1", 3)
+	undeployed.Tick = "sats"
+	result, err = e2.ApplyBlock(800001, []*models.Tx{full, orphan, undeployed})
+	assert.Nil(t, err)
+	assert.Equal(t, models.TxStatusInvalid, full.Status)
+	assert.Equal(t, models.TxStatusInvalid, orphan.Status)
+	assert.Equal(t, models.TxStatusInvalid, undeployed.Status)
+	assert.Len(t, result.Addresses, 0)
+}
+
+func Test_ApplyBlockPatch(t *testing.T) {
+	tick := &models.Tick{Name: "ordi", Supply: "1000", MintLimit: "100", MintedAmount: "0", DeployTx: "deploy"}
+	state := NewMemoryState(tick)
+	e := &Engine{Protocol: "brc-20", State: state}
+
+	// A patch is applied even if the rules say it's invalid, and an invalid patch is skipped.
+	patched := newTx("mint1", "mint", "", "bc1qa", "200", 1)
+	patched.Reason = "patch:over the limit accepted"
+	patched.Status = models.TxStatusValid
+	skipped := newTx("mint2", "mint", "", "bc1qa", "50", 2)
+	skipped.Reason = "patch:rejected"
+	skipped.Status = models.TxStatusInvalid
+	// The amount forced by a patch is used instead of the amount of the tx.
+	forced := newTx("mint3", "mint", "", "bc1qb", "100", 3)
+	forced.Reason = "patch:half of it"
+	forced.Status = models.TxStatusValid
+	forced.ValidAmount = "50"
+	result, err := e.ApplyBlock(800000, []*models.Tx{patched, skipped, forced})
+	assert.Nil(t, err)
+	assert.Len(t, result.Txs, 0)
+	assert.Len(t, result.Patches, 3)
+	assert.Equal(t, models.TxStatusValid, patched.Status)
+	assert.Equal(t, "patch:over the limit accepted", patched.Reason)
+	assert.Equal(t, models.TxStatusInvalid, skipped.Status)
+	assert.Equal(t, "50", forced.ValidAmount)
+	assert.Equal(t, "250", tick.MintedAmount)
+	a, _ := state.Address("ordi", "bc1qa")
+	assert.Equal(t, "200", a.Available)
+	b, _ := state.Address("ordi", "bc1qb")
+	assert.Equal(t, "50", b.Available)
+}
+
+func Test_ApplyBlockParallel(t *testing.T) {
+	newBlock := func() (*MemoryState, []*models.Tx) {
+		state := NewMemoryState(
+			&models.Tick{Name: "ordi", Supply: "1000", MintLimit: "600", MintedAmount: "0", DeployTx: "deploy1"},
+			&models.Tick{Name: "SATS", Supply: "500", MintLimit: "500", MintedAmount: "0", DeployTx: "deploy2"},
+			&models.Tick{Name: "pepe", Supply: "100", MintLimit: "100", MintedAmount: "0", DeployTx: "deploy3"},
+		)
+		var txs []*models.Tx
+		for i, tick := range []string{"ordi", "sats", "pepe", "ordi", "SATS", "none", "pepe", "ordi"} {
+			tx := newTx(fmt.Sprintf("mint%d", i), "mint", "", fmt.Sprintf("bc1q%d", i%3), "400", i)
+			tx.Tick = tick
+			txs = append(txs, tx)
+		}
+		for i, tick := range []string{"ordi", "sats", "pepe"} {
+			inscribeId := strings.Repeat(fmt.Sprint(i), 64)
+			inscribe := newTx(inscribeId, "inscribe-transfer", "", "bc1q0", "50", 10+i)
+			inscribe.Tick = tick
+			transfer := newTx(strings.Repeat("f", 63)+fmt.Sprint(i), "transfer", "bc1q0", "bc1q9", "50", 20+i)
+			transfer.Tick = tick
+			transfer.InscriptionId = inscribeId + "i0"
+			txs = append(txs, inscribe, transfer)
+		}
+		return state, txs
+	}
+
+	seqState, seqTxs := newBlock()
+	seqResult, err := (&Engine{Protocol: "brc-20", State: seqState}).ApplyBlock(800000, seqTxs)
+	assert.Nil(t, err)
+	parState, parTxs := newBlock()
+	parResult, err := (&Engine{Protocol: "brc-20", State: parState, Workers: 4}).ApplyBlock(800000, parTxs)
+	assert.Nil(t, err)
+
+	assert.NotEmpty(t, parResult.Events)
+	assert.Equal(t, len(seqResult.Txs), len(parResult.Txs))
+	for i, tx := range seqResult.Txs {
+		assert.Equal(t, tx.TxId, parResult.Txs[i].TxId)
+		assert.Equal(t, tx.Status, parResult.Txs[i].Status)
+		assert.Equal(t, tx.Reason, parResult.Txs[i].Reason)
+		assert.Equal(t, tx.ValidAmount, parResult.Txs[i].ValidAmount)
+	}
+	assert.Equal(t, seqResult.Ticks, parResult.Ticks)
+	assert.Equal(t, seqResult.Addresses, parResult.Addresses)
+	assert.Equal(t, seqResult.Events, parResult.Events)
+	assert.Len(t, parResult.Check(), 0)
+}
+
+func Test_ApplyBlockParallelLinked(t *testing.T) {
+	newBlock := func() (*MemoryState, []*models.Tx) {
+		state := NewMemoryState(
+			&models.Tick{Name: "ordi", Supply: "1000", MintLimit: "600", MintedAmount: "0", DeployTx: "deploy1"},
+			&models.Tick{Name: "sats", Supply: "1000", MintLimit: "600", MintedAmount: "0", DeployTx: "deploy2"},
+		)
+		mintSats := newTx("mint0", "mint", "", "bc1q0", "400", 0)
+		mintSats.Tick = "sats"
+		mintOrdi := newTx("mint1", "mint", "", "bc1q0", "400", 1)
+		inscribeSats := newTx(strings.Repeat("a", 64), "inscribe-transfer", "", "bc1q0", "50", 2)
+		inscribeSats.Tick = "sats"
+		inscribeOrdi := newTx(strings.Repeat("b", 64), "inscribe-transfer", "", "bc1q0", "50", 3)
+		// The transfer of ordi takes the status of the first tx of its inscription, which is of sats.
+		transfer := newTx(strings.Repeat("c", 64), "transfer", "bc1q0", "bc1q9", "50", 4)
+		transfer.InscriptionId = inscribeSats.TxId + "i0"
+		return state, []*models.Tx{mintSats, mintOrdi, inscribeSats, inscribeOrdi, transfer}
+	}
+
+	seqState, seqTxs := newBlock()
+	seqResult, err := (&Engine{Protocol: "brc-20", State: seqState}).ApplyBlock(800000, seqTxs)
+	assert.Nil(t, err)
+	parState, parTxs := newBlock()
+	parResult, err := (&Engine{Protocol: "brc-20", State: parState, Workers: 4}).ApplyBlock(800000, parTxs)
+	assert.Nil(t, err)
+
+	assert.Equal(t, models.TxStatusValid, seqTxs[4].Status)
+	for i, tx := range seqResult.Txs {
+		assert.Equal(t, tx.Status, parResult.Txs[i].Status)
+		assert.Equal(t, tx.Reason, parResult.Txs[i].Reason)
+	}
+	assert.Equal(t, seqResult.Events, parResult.Events)
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"fmt"
+	"libord/internal/models"
+)
+
+// Rule is a validation rule checked on a tx, with the values it compared.
+type Rule struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+func (r *Rule) String() string {
+	result := "fail"
+	if r.Passed {
+		result = "pass"
+	}
+	return fmt.Sprintf("[%s] %s: %s", result, r.Name, r.Detail)
+}
+
+// Explain checks the rules on the tx against the state just before the tx, by the same checks and in the same order as ApplyBlock.
+// It stops at the first failed rule as the validation does. The state is only read.
+func (e *Engine) Explain(tx *models.Tx) (rules []*Rule, err error) {
+	r := &recorder{}
+	defer func() {
+		rules = r.rules
+	}()
+
+	var tick *models.Tick
+	if tick, err = e.State.Tick(tx.Tick); err != nil {
+		return
+	}
+	if e.validateTick(tx, tick, r) != "" {
+		return
+	}
+	var sender, recipient *models.Address
+	if tx.From != "" {
+		if sender, err = e.State.Address(tick.Name, tx.From); err != nil {
+			return
+		}
+	}
+	if tx.To != "" {
+		if recipient, err = e.State.Address(tick.Name, tx.To); err != nil {
+			return
+		}
+	}
+	if e.validateCommon(tx, r) != "" {
+		return
+	}
+	// The former txs of the block are not known here, the status of the inscribe-transfer tx is read from the state.
+	_, err = e.validateOp(tx, tick, sender, recipient, nil, r)
+	return
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"libord/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Explain(t *testing.T) {
+	tick := &models.Tick{Name: "ordi", Supply: "1000", MintLimit: "600", MintedAmount: "800", DeployTx: "deploy", DeployTime: 1680000000}
+	state := NewMemoryState(tick)
+	e := &Engine{Protocol: "brc-20", State: state}
+
+	rules, err := e.Explain(newTx("mint1", "mint", "", "bc1qa", "600", 1))
+	assert.Nil(t, err)
+	assert.True(t, rules[len(rules)-1].Passed)
+	assert.Equal(t, "last mint", rules[len(rules)-1].Name)
+
+	rules, err = e.Explain(newTx("mint2", "mint", "", "bc1qa", "700", 2))
+	assert.Nil(t, err)
+	assert.False(t, rules[len(rules)-1].Passed)
+	assert.Equal(t, "mint limit", rules[len(rules)-1].Name)
+	assert.Equal(t, "700 <= 600", rules[len(rules)-1].Detail)
+
+	a, _ := state.Address("ordi", "bc1qa")
+	a.Transferable = "50"
+	inscribeId := strings.Repeat("a", 64)
+	transfer := newTx(inscribeId, "transfer", "bc1qa", "bc1qc", "100", 3)
+	rules, err = e.Explain(transfer)
+	assert.Nil(t, err)
+	assert.False(t, rules[len(rules)-1].Passed)
+	assert.Equal(t, "[fail] transferable balance: 50 transferable of bc1qa >= 100", rules[len(rules)-1].String())
+
+	// The state is not changed by the explanation.
+	assert.Equal(t, "800", tick.MintedAmount)
+	assert.Equal(t, "", a.Available)
+}
+
+func Test_ExplainMatchesApply(t *testing.T) {
+	tick := &models.Tick{Name: "ordi", Supply: "1000", MintLimit: "600", MintedAmount: "0", DeployTx: "deploy", DeployTime: 1680000000}
+	state := NewMemoryState(tick)
+	e := &Engine{Protocol: "brc-20", State: state}
+	inscribeId := strings.Repeat("a", 64)
+	transfer := newTx(inscribeId, "transfer", "bc1qa", "bc1qc", "100", 8)
+	transfer.InscriptionId = inscribeId + "i0"
+	txs := []*models.Tx{
+		newTx("deploy", "deploy", "", "bc1qd", "", 0),
+		newTx("deploy2", "deploy", "", "bc1qd", "", 1),
+		newTx("mint1", "mint", "", "bc1qa", "600", 2),
+		newTx("mint2", "mint", "", "bc1qa", "700", 3),
+		newTx("mint3", "mint", "", "bc1qb", "600", 4),
+		newTx("mint4", "mint", "", "bc1qb", "1", 5),
+		newTx("inscribe1", "inscribe-transfer", "", "bc1qa", "601", 6),
+		newTx(inscribeId, "inscribe-transfer", "", "bc1qa", "100", 7),
+		transfer,
+		newTx("burn", "burn", "", "bc1qa", "1", 9),
+		newTx("empty", "mint", "", "", "1", 10),
+	}
+	txs[len(txs)-2].Content = ""
+
+	// Every tx is explained just before it's applied, the verdict and the failed rule are those of the validation.
+	for i, tx := range txs {
+		rules, err := e.Explain(tx)
+		assert.Nil(t, err)
+		result, err := e.ApplyBlock(800000+int64(i), []*models.Tx{tx})
+		assert.Nil(t, err)
+		assert.Nil(t, state.Commit(result))
+		last := rules[len(rules)-1]
+		if tx.Status == models.TxStatusValid {
+			for _, rule := range rules {
+				assert.True(t, rule.Passed, "%s %s", tx.TxId, rule)
+			}
+		} else {
+			assert.False(t, last.Passed, "%s %s", tx.TxId, last)
+			assert.NotEqual(t, "", tx.Reason)
+		}
+	}
+	assert.Equal(t, models.TxStatusValid, transfer.Status)
+}
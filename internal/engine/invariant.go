@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Violation is a broken invariant of the validated state.
+type Violation struct {
+	Tick    string
+	Address string // empty if the invariant is about the whole tick
+	Detail  string
+}
+
+func (v *Violation) String() string {
+	if v.Address == "" {
+		return fmt.Sprintf("tick:%s %s", v.Tick, v.Detail)
+	}
+	return fmt.Sprintf("tick:%s address:%s %s", v.Tick, v.Address, v.Detail)
+}
+
+// InvariantError is the error of the invariants broken by a block, validating the block again doesn't fix it.
+type InvariantError struct {
+	Block      int64
+	Violations []*Violation
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("%d invariants broken at block:%d", len(e.Violations), e.Block)
+}
+
+// Fatal tells the follower to stop instead of retrying the block.
+func (e *InvariantError) Fatal() bool {
+	return true
+}
+
+// Check verifies the invariants on the changes of the block, assuming they held before the block.
+// The change of the sum of balances of a tick must equal the change of its minted amount.
+func (r *Result) Check() (violations []*Violation) {
+	balanceDelta := make(map[string]decimal.Decimal)
+	for _, address := range r.Addresses {
+		violations = append(violations, CheckBalance(address)...)
+		after := conv.Decimal(address.Available).Add(conv.Decimal(address.Transferable))
+		key := strings.ToLower(address.Tick)
+		balanceDelta[key] = balanceDelta[key].Add(after.Sub(r.balanceBefore[addressKey(address.Tick, address.Address)]))
+	}
+	mintedDelta := make(map[string]decimal.Decimal)
+	for _, tick := range r.Ticks {
+		violations = append(violations, CheckMinted(tick)...)
+		mintedDelta[strings.ToLower(tick.Name)] = conv.Decimal(tick.MintedAmount).Sub(r.mintedBefore[strings.ToLower(tick.Name)])
+	}
+
+	var keys []string
+	for key := range r.mintedBefore {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !balanceDelta[key].Equal(mintedDelta[key]) {
+			violations = append(violations, &Violation{Tick: key, Detail: fmt.Sprintf("balances changed by %s but minted changed by %s at block:%d", balanceDelta[key].String(), mintedDelta[key].String(), r.Block)})
+		}
+	}
+	return
+}
+
+// CheckBalance verifies that no balance of the address is negative.
+func CheckBalance(address *models.Address) (violations []*Violation) {
+	if conv.Decimal(address.Available).IsNegative() {
+		violations = append(violations, &Violation{Tick: address.Tick, Address: address.Address, Detail: fmt.Sprintf("available:%s is negative", address.Available)})
+	}
+	if conv.Decimal(address.Transferable).IsNegative() {
+		violations = append(violations, &Violation{Tick: address.Tick, Address: address.Address, Detail: fmt.Sprintf("transferable:%s is negative", address.Transferable)})
+	}
+	return
+}
+
+// CheckMinted verifies that the minted amount of the tick doesn't exceed its supply.
+func CheckMinted(tick *models.Tick) (violations []*Violation) {
+	if conv.Decimal(tick.MintedAmount).GreaterThan(conv.Decimal(tick.Supply)) {
+		violations = append(violations, &Violation{Tick: tick.Name, Detail: fmt.Sprintf("minted:%s exceeds supply:%s", tick.MintedAmount, tick.Supply)})
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"libord/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Check(t *testing.T) {
+	tick := &models.Tick{Name: "ordi", Supply: "21000000", MintedAmount: "1000"}
+	sender := &models.Address{Tick: "ordi", Address: "bc1qa", Available: "600", Transferable: "400"}
+	recipient := &models.Address{Tick: "ordi", Address: "bc1qb"}
+
+	// A valid transfer moves the balance without changing the sum.
+	result := newResult(800000)
+	result.touch(tick, sender, recipient)
+	sender.Transferable = "0"
+	recipient.Available = "400"
+	result.Addresses = []*models.Address{sender, recipient}
+	assert.Len(t, result.Check(), 0)
+
+	// A credit without the debit creates tokens.
+	result = newResult(800001)
+	result.touch(tick, sender, recipient)
+	recipient.Available = "800"
+	result.Addresses = []*models.Address{recipient}
+	violations := result.Check()
+	assert.Len(t, violations, 1)
+	assert.Equal(t, violations[0].Tick, "ordi")
+
+	// A mint changes both the balance and the minted amount.
+	result = newResult(800002)
+	result.touch(tick, recipient)
+	recipient.Available = "1800"
+	tick.MintedAmount = "2000"
+	result.Addresses = []*models.Address{recipient}
+	result.Ticks = []*models.Tick{tick}
+	assert.Len(t, result.Check(), 0)
+
+	// Negative balances and over-minted ticks are reported.
+	result = newResult(800003)
+	result.touch(tick, sender)
+	sender.Available = "-1"
+	tick.MintedAmount = "21000001"
+	result.Addresses = []*models.Address{sender}
+	result.Ticks = []*models.Tick{tick}
+	violations = result.Check()
+	assert.Len(t, violations, 3)
+	assert.Equal(t, violations[0].Address, "bc1qa")
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"libord/internal/models"
+	"strings"
+	"sync"
+)
+
+// MemoryState keeps the whole state in memory, e.g: for tests and dry runs.
+type MemoryState struct {
+	ticks             map[string]*models.Tick
+	addresses         map[string]*models.Address
+	inscribeTransfers map[string]bool // txid,tick => valid
+	mu                sync.Mutex
+}
+
+func NewMemoryState(ticks ...*models.Tick) *MemoryState {
+	m := &MemoryState{
+		ticks:             make(map[string]*models.Tick),
+		addresses:         make(map[string]*models.Address),
+		inscribeTransfers: make(map[string]bool),
+	}
+	for _, tick := range ticks {
+		m.ticks[strings.ToLower(tick.Name)] = tick
+	}
+	return m
+}
+
+func (m *MemoryState) Tick(name string) (*models.Tick, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ticks[strings.ToLower(name)], nil
+}
+
+func (m *MemoryState) Address(tick, address string) (*models.Address, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := addressKey(tick, address)
+	if m.addresses[key] == nil {
+		m.addresses[key] = &models.Address{Tick: tick, Address: address}
+	}
+	return m.addresses[key], nil
+}
+
+func (m *MemoryState) ValidInscribeTransfer(txid, tick string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inscribeTransfers[strings.ToLower(txid+","+tick)], nil
+}
+
+func (m *MemoryState) Commit(result *Result) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, txs := range [][]*models.Tx{result.Txs, result.Patches} {
+		for _, tx := range txs {
+			if strings.EqualFold(tx.Operation, "inscribe-transfer") && tx.Status == models.TxStatusValid {
+				m.inscribeTransfers[strings.ToLower(tx.TxId+","+tx.Tick)] = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Result is the state changed by a block.
+type Result struct {
+	Block     int64
+	Txs       []*models.Tx // validated txs, their status, reason and valid amount need to be saved
+	Patches   []*models.Tx // manual patches, their status, reason and valid amount are forced by the patch
+	Ticks     []*models.Tick
+	Addresses []*models.Address
+	Events    []*models.BalanceEvent
+
+	tickIdx    map[string]int
+	addressIdx map[string]int
+	eventIdx   map[string]int // tx and address => index of events
+
+	mintedBefore  map[string]decimal.Decimal // tick => minted amount before the block
+	balanceBefore map[string]decimal.Decimal // tick,address => available + transferable before the block
+
+	// The index in the block of the tx being applied, and of the txs which marked the ticks, addresses and events,
+	// for merging the results of ticks applied concurrently in the order of txs.
+	seq                              int
+	tickSeqs, addressSeqs, eventSeqs []int
+}
+
+func newResult(block int64) *Result {
+	return &Result{
+		Block:         block,
+		tickIdx:       make(map[string]int),
+		addressIdx:    make(map[string]int),
+		eventIdx:      make(map[string]int),
+		mintedBefore:  make(map[string]decimal.Decimal),
+		balanceBefore: make(map[string]decimal.Decimal),
+	}
+}
+
+// touch: remember the state of the tick and addresses before the block changes them, for checking invariants of the block.
+func (r *Result) touch(tick *models.Tick, addresses ...*models.Address) {
+	if _, ok := r.mintedBefore[strings.ToLower(tick.Name)]; !ok {
+		r.mintedBefore[strings.ToLower(tick.Name)] = conv.Decimal(tick.MintedAmount)
+	}
+	for _, address := range addresses {
+		if address == nil {
+			continue
+		}
+		key := addressKey(address.Tick, address.Address)
+		if _, ok := r.balanceBefore[key]; !ok {
+			r.balanceBefore[key] = conv.Decimal(address.Available).Add(conv.Decimal(address.Transferable))
+		}
+	}
+}
+
+func (r *Result) markTick(tick *models.Tick) {
+	key := strings.ToLower(tick.Name)
+	if _, ok := r.tickIdx[key]; !ok {
+		r.tickIdx[key] = len(r.Ticks)
+		r.Ticks = append(r.Ticks, tick)
+		r.tickSeqs = append(r.tickSeqs, r.seq)
+	}
+}
+
+func (r *Result) markAddress(address *models.Address) {
+	key := addressKey(address.Tick, address.Address)
+	if _, ok := r.addressIdx[key]; !ok {
+		r.addressIdx[key] = len(r.Addresses)
+		r.Addresses = append(r.Addresses, address)
+		r.addressSeqs = append(r.addressSeqs, r.seq)
+	}
+}
+
+// journal: record the balance change of an address made by the tx, changes of the same address in one tx are merged into one event.
+// It must be called after the balance of the address is changed.
+func (r *Result) journal(tx *models.Tx, address *models.Address, availableDelta, transferableDelta decimal.Decimal) {
+	r.markAddress(address)
+	key := strings.ToLower(fmt.Sprintf("%s,%s,%d,%s", tx.TxId, tx.Operation, tx.InputIndex, address.Address))
+	if idx, ok := r.eventIdx[key]; ok {
+		event := r.Events[idx]
+		event.AvailableDelta = conv.Decimal(event.AvailableDelta).Add(availableDelta).String()
+		event.TransferableDelta = conv.Decimal(event.TransferableDelta).Add(transferableDelta).String()
+		event.Available = conv.Decimal(address.Available).String()
+		event.Transferable = conv.Decimal(address.Transferable).String()
+		return
+	}
+	r.eventIdx[key] = len(r.Events)
+	r.eventSeqs = append(r.eventSeqs, r.seq)
+	r.Events = append(r.Events, &models.BalanceEvent{
+		TxId:              tx.TxId,
+		Operation:         tx.Operation,
+		InputIndex:        tx.InputIndex,
+		Address:           address.Address,
+		Tick:              address.Tick,
+		AvailableDelta:    availableDelta.String(),
+		TransferableDelta: transferableDelta.String(),
+		Available:         conv.Decimal(address.Available).String(),
+		Transferable:      conv.Decimal(address.Transferable).String(),
+		Block:             tx.BlockHeight,
+		Position:          tx.Position,
+	})
+}
+
+// mergeResults: merge the results of the ticks applied concurrently, the ticks, addresses and events are ordered by
+// the txs which marked them, as if the txs were applied one by one.
+func mergeResults(block int64, txs []*models.Tx, parts []*Result) *Result {
+	r := newResult(block)
+	patches := make(map[*models.Tx]bool)
+	for _, part := range parts {
+		for _, tx := range part.Patches {
+			patches[tx] = true
+		}
+		for key, value := range part.mintedBefore {
+			r.mintedBefore[key] = value
+		}
+		for key, value := range part.balanceBefore {
+			r.balanceBefore[key] = value
+		}
+	}
+	for _, tx := range txs {
+		if patches[tx] {
+			r.Patches = append(r.Patches, tx)
+		} else {
+			r.Txs = append(r.Txs, tx)
+		}
+	}
+
+	type item struct {
+		seq   int
+		value any
+	}
+	var ticks, addresses, events []item
+	for _, part := range parts {
+		for i, tick := range part.Ticks {
+			ticks = append(ticks, item{part.tickSeqs[i], tick})
+		}
+		for i, address := range part.Addresses {
+			addresses = append(addresses, item{part.addressSeqs[i], address})
+		}
+		for i, event := range part.Events {
+			events = append(events, item{part.eventSeqs[i], event})
+		}
+	}
+	// The items of a tx come from one part in order, so a stable sort keeps their order.
+	for _, items := range [][]item{ticks, addresses, events} {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].seq < items[j].seq
+		})
+	}
+	for _, it := range ticks {
+		r.seq = it.seq
+		r.markTick(it.value.(*models.Tick))
+	}
+	for _, it := range addresses {
+		r.seq = it.seq
+		r.markAddress(it.value.(*models.Address))
+	}
+	for _, it := range events {
+		event := it.value.(*models.BalanceEvent)
+		r.eventIdx[strings.ToLower(fmt.Sprintf("%s,%s,%d,%s", event.TxId, event.Operation, event.InputIndex, event.Address))] = len(r.Events)
+		r.eventSeqs = append(r.eventSeqs, it.seq)
+		r.Events = append(r.Events, event)
+	}
+	return r
+}
+
+func addressKey(tick, address string) string {
+	return strings.ToLower(fmt.Sprintf("%s,%s", tick, address))
+}
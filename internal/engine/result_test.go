@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"libord/internal/models"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Journal(t *testing.T) {
+	result := newResult(800000)
+	address := &models.Address{Tick: "ordi", Address: "bc1qa", Available: "100"}
+
+	mint := &models.Tx{TxId: "a1", Operation: "mint", BlockHeight: 800000, Position: 1}
+	result.journal(mint, address, decimal.NewFromInt(100), decimal.Zero)
+
+	// A transfer to the sender itself is journaled as one event.
+	transfer := &models.Tx{TxId: "b2", Operation: "transfer", BlockHeight: 800000, Position: 2}
+	address.Transferable = "40"
+	result.journal(transfer, address, decimal.Zero, decimal.NewFromInt(-10))
+	address.Available = "110"
+	result.journal(transfer, address, decimal.NewFromInt(10), decimal.Zero)
+
+	assert.Len(t, result.Addresses, 1)
+	assert.Len(t, result.Events, 2)
+	assert.Equal(t, result.Events[0].AvailableDelta, "100")
+	assert.Equal(t, result.Events[0].Available, "100")
+	assert.Equal(t, result.Events[1].AvailableDelta, "10")
+	assert.Equal(t, result.Events[1].TransferableDelta, "-10")
+	assert.Equal(t, result.Events[1].Available, "110")
+	assert.Equal(t, result.Events[1].Transferable, "40")
+	assert.Equal(t, result.Events[1].Position, 2)
+}
@@ -0,0 +1,17 @@
+package engine
+
+import "libord/internal/models"
+
+// State is where the engine reads the balances from. The engine changes the returned objects in place,
+// reports the changed ones in Result, and the owner of the state writes them back in Commit.
+type State interface {
+	// Tick returns the tick by name, nil if it has not been deployed.
+	Tick(name string) (*models.Tick, error)
+	// Address returns the balance of the address, the same object must be returned for the same tick and address until it's committed.
+	// If the address has no balance record yet, a new one with empty balance is returned.
+	Address(tick, address string) (*models.Address, error)
+	// ValidInscribeTransfer reports whether the inscribe-transfer tx of the tick was valid in a previous block.
+	ValidInscribeTransfer(txid, tick string) (bool, error)
+	// Commit writes the changes of a block back.
+	Commit(result *Result) error
+}
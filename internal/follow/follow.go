@@ -0,0 +1,71 @@
+package follow
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BlockIndexer indexes the next confirmed block, e.g: *indexer.Indexer.
+type BlockIndexer interface {
+	Next(minConfirmation int) (block int64, ok bool, err error)
+}
+
+// BlockValidator validates all indexed blocks, e.g: *validator.Validator.
+type BlockValidator interface {
+	Run() error
+}
+
+// Follower keeps indexing the confirmed blocks one by one and validates each of them straight away.
+type Follower struct {
+	Chain           string
+	Indexer         BlockIndexer
+	Validator       BlockValidator // nil means the blocks are only indexed, e.g: ord-indexer run --follow
+	MinConfirmation int
+	PollInterval    time.Duration   // how long to wait for a new block before checking the tip again
+	Notify          <-chan struct{} // optional, wakes the follower up before the poll interval, e.g: on zmq block notifications
+}
+
+// Run follows the chain until stop is closed, the block being indexed and validated is always finished before returning.
+// Errors are logged and retried after the poll interval, as the node or database may come back later. A fatal error of
+// the validator, e.g: a broken invariant, stops the follower and is returned, since retrying the block doesn't fix it.
+func (f *Follower) Run(stop <-chan struct{}) error {
+	log.Printf("following %s blocks", f.Chain)
+	for {
+		select {
+		case <-stop:
+			log.Printf("stop following %s blocks", f.Chain)
+			return nil
+		default:
+		}
+
+		if block, ok, err := f.Indexer.Next(f.MinConfirmation); err != nil {
+			log.Printf("[ERROR] index next block error:%+v", err)
+		} else if ok {
+			if f.Validator == nil {
+				continue
+			}
+			if err = f.Validator.Run(); err != nil && isFatal(err) {
+				return errors.Wrapf(err, "validate block:%d", block)
+			} else if err != nil {
+				log.Printf("[ERROR] validate block:%d error:%+v", block, err)
+			} else {
+				// There may be more confirmed blocks, don't wait.
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+		case <-f.Notify:
+		case <-time.After(f.PollInterval):
+		}
+	}
+}
+
+// isFatal: whether retrying doesn't fix the error, i.e., it has a Fatal method which returns true, e.g: engine.InvariantError.
+func isFatal(err error) bool {
+	var fatal interface{ Fatal() bool }
+	return errors.As(err, &fatal) && fatal.Fatal()
+}
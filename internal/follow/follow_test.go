@@ -0,0 +1,128 @@
+package follow
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIndexer struct {
+	sync.Mutex
+	tip     int64
+	indexed []int64
+	onIndex func(block int64)
+}
+
+func (f *fakeIndexer) Next(minConfirmation int) (block int64, ok bool, err error) {
+	f.Lock()
+	defer f.Unlock()
+	var last int64
+	if len(f.indexed) > 0 {
+		last = f.indexed[len(f.indexed)-1]
+	}
+	if last >= f.tip-int64(minConfirmation) {
+		return
+	}
+	block = last + 1
+	f.indexed = append(f.indexed, block)
+	if f.onIndex != nil {
+		f.onIndex(block)
+	}
+	return block, true, nil
+}
+
+type fakeValidator struct {
+	runs int
+	ran  chan struct{}
+	errs []error // returned by the runs one by one
+}
+
+func (f *fakeValidator) Run() (err error) {
+	f.runs++
+	if f.ran != nil {
+		f.ran <- struct{}{}
+	}
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	return
+}
+
+type fatalError struct{}
+
+func (e fatalError) Error() string {
+	return "fatal"
+}
+
+func (e fatalError) Fatal() bool {
+	return true
+}
+
+func Test_FollowerStop(t *testing.T) {
+	stop := make(chan struct{})
+	_indexer := &fakeIndexer{tip: 10}
+	// The stop signal arrives while indexing block 3, which is still validated.
+	_indexer.onIndex = func(block int64) {
+		if block == 3 {
+			close(stop)
+		}
+	}
+	_validator := &fakeValidator{}
+	f := &Follower{Chain: "btc", Indexer: _indexer, Validator: _validator, PollInterval: time.Hour}
+	assert.Nil(t, f.Run(stop))
+	assert.Equal(t, []int64{1, 2, 3}, _indexer.indexed)
+	assert.Equal(t, 3, _validator.runs)
+}
+
+func Test_FollowerNotify(t *testing.T) {
+	stop := make(chan struct{})
+	notify := make(chan struct{})
+	_indexer := &fakeIndexer{tip: 5}
+	_validator := &fakeValidator{ran: make(chan struct{}, 10)}
+	f := &Follower{Chain: "btc", Indexer: _indexer, Validator: _validator, MinConfirmation: 2, PollInterval: time.Hour, Notify: notify}
+	done := make(chan error)
+	go func() {
+		done <- f.Run(stop)
+	}()
+
+	// Blocks up to the confirmed tip are indexed without waiting, the next one after the notification.
+	for i := 0; i < 3; i++ {
+		<-_validator.ran
+	}
+	_indexer.Lock()
+	_indexer.tip = 6
+	_indexer.Unlock()
+	notify <- struct{}{}
+	<-_validator.ran
+	close(stop)
+	assert.Nil(t, <-done)
+	assert.Equal(t, []int64{1, 2, 3, 4}, _indexer.indexed)
+}
+
+func Test_FollowerIndexOnly(t *testing.T) {
+	stop := make(chan struct{})
+	_indexer := &fakeIndexer{tip: 10}
+	_indexer.onIndex = func(block int64) {
+		if block == 4 {
+			close(stop)
+		}
+	}
+	f := &Follower{Chain: "btc", Indexer: _indexer, PollInterval: time.Hour}
+	assert.Nil(t, f.Run(stop))
+	assert.Equal(t, []int64{1, 2, 3, 4}, _indexer.indexed)
+}
+
+func Test_FollowerErrors(t *testing.T) {
+	// A transient error is retried after the poll interval, a fatal one stops the follower.
+	_indexer := &fakeIndexer{tip: 10}
+	_validator := &fakeValidator{errs: []error{nil, errors.New("connection refused"), errors.WithStack(fatalError{})}}
+	f := &Follower{Chain: "btc", Indexer: _indexer, Validator: _validator, PollInterval: time.Millisecond}
+	err := f.Run(make(chan struct{}))
+	assert.NotNil(t, err)
+	assert.True(t, isFatal(err))
+	assert.Equal(t, []int64{1, 2, 3}, _indexer.indexed)
+	assert.Equal(t, 3, _validator.runs)
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"libord/internal/models"
+	"libord/pkg/orm"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Envelope is an ord envelope decoded from an input of a tx.
+type Envelope struct {
+	InputIndex int
+	Meta       string // content type
+	Content    string
+}
+
+// SatPath is how the inscribed sat is tracked from an input of a transfer tx to its output, the offsets are in sats
+// counted from the first input or output of the tx.
+type SatPath struct {
+	InputIndex    int
+	PrevSatOffset string // the offset and end of the inscribed sats in the spent output
+	InputOffset   int64  // the offset of the inscribed sat in all inputs
+	InputEnd      int64
+	InputTotal    int64
+	OutputTotal   int64
+	Fee           int64 // the fee is taken as an extra output to the address of the last input
+	Outputs       []*SatOutput
+	OutputIndex   int // the last output starting before the inscribed sat
+	SatOffset     string
+	To            string
+}
+
+type SatOutput struct {
+	Address string
+	Offset  int64
+	Value   int64
+	IsFee   bool
+}
+
+// Envelopes decodes the ord envelopes in the inputs of the tx, whether they are of the protocol or not.
+func (s *Indexer) Envelopes(txid string) (ret []*Envelope, err error) {
+	var tx map[string]any
+	if tx, err = s.btc().GetTransactionByHash(txid); err != nil {
+		return
+	}
+	for inputIdx, vin := range tx["vin"].([]any) {
+		for _, hex := range s.envelopeHexes(vin.(map[string]any)) {
+			if meta, contents := s.parseOrd(txid, hex); meta != "" || len(contents) > 0 {
+				ret = append(ret, &Envelope{InputIndex: inputIdx, Meta: meta, Content: string(contents)})
+			}
+		}
+	}
+	return
+}
+
+// SatPath tracks the inscribed sat of the transfer tx again, as it was done when the tx was indexed.
+func (s *Indexer) SatPath(transferTx *models.Tx) (path *SatPath, err error) {
+	if !strings.EqualFold(transferTx.Operation, "transfer") || len(transferTx.InscriptionId) < 64 {
+		err = errors.Errorf("tx:%s op:%s is not a transfer", transferTx.TxId, transferTx.Operation)
+		return
+	}
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var inscribeTx *models.Tx
+	if inscribeTx, err = orm.First[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", transferTx.InscriptionId[0:64]).Where("Operation", "inscribe-transfer")); err != nil {
+		return
+	} else if inscribeTx == nil {
+		err = errors.Errorf("inscribe-transfer tx:%s not found", transferTx.InscriptionId[0:64])
+		return
+	}
+	var tx map[string]any
+	if tx, err = s.btc().GetTransactionByHash(transferTx.TxId); err != nil {
+		return
+	}
+	path = &SatPath{}
+	_, _, _, err = s.calReceiveAddress(inscribeTx.SatOffset, transferTx.InputIndex, make(map[int]string), tx["vin"].([]any), tx["vout"].([]any), path)
+	return
+}
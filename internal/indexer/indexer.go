@@ -1,6 +1,7 @@
 package indexer
 
 import (
+	"context"
 	"database/sql"
 	"encoding/binary"
 	"fmt"
@@ -34,6 +35,25 @@ type Indexer struct {
 	Chain string
 	Db    *sql.DB
 	Rpc   *rpc.Btc
+	Ctx   context.Context // the queries and rpc calls are cancelled with it, e.g: on signals, context.Background() if nil
+}
+
+// context: the Ctx of the indexer, context.Background() if nil.
+func (s *Indexer) context() context.Context {
+	if s.Ctx == nil {
+		return context.Background()
+	}
+	return s.Ctx
+}
+
+// newOrm: an orm whose calls are cancelled with the Ctx of the indexer, or by the db timeout.
+func (s *Indexer) newOrm() *orm.Orm {
+	return &orm.Orm{Db: s.Db, Ctx: s.Ctx, Timeout: config.Instance().DbTimeout()}
+}
+
+// btc: the rpc client whose calls are cancelled with the Ctx of the indexer.
+func (s *Indexer) btc() *rpc.Btc {
+	return s.Rpc.WithContext(s.Ctx)
 }
 
 func (s *Indexer) Run(startBlock, endBlock int64, minConfirmation int) (err error) {
@@ -41,45 +61,28 @@ func (s *Indexer) Run(startBlock, endBlock int64, minConfirmation int) (err erro
 		err = errors.Errorf("db or rpc is nil, please check")
 		return
 	}
-	_orm := &orm.Orm{Db: s.Db}
-	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 
-	dictKey := strings.ToLower(s.Chain) + ".ord.indexer.block"
+	saveDict := true
 	if startBlock == 0 || endBlock == 0 {
 		// No specified block, query the last completed block from the database.
-		obj := &models.Dict{}
-		block, _err := _orm.One(_m.Bind(obj).Where("Key", dictKey), "value")
-		if _err != nil {
-			err = _err
+		if startBlock, err = s.lastBlock(); err != nil {
 			return
 		}
-		startBlock = conv.Int64(block)
-
-		if startBlock <= 0 {
-			startBlock = config.Instance().OrdGenesisBlock[strings.ToLower(s.Chain)]
-			obj := &models.Dict{Key: dictKey, Value: conv.String(startBlock)}
-			if _, _, err = _orm.Save(_m.Bind(obj).BatchData(obj)); err != nil {
-				return
-			}
-		}
-		endBlock, err = s.Rpc.GetBlockNumber()
-		if err != nil {
+		if endBlock, err = s.confirmedBlock(minConfirmation); err != nil {
 			return
 		}
-		endBlock = endBlock - int64(minConfirmation)
 	} else {
 		// Indexed at a specified block height, no need to update dict table.
-		dictKey = ""
+		saveDict = false
 	}
 
 	log.Printf("ord index block start from %d to %d", startBlock, endBlock)
 	for block := startBlock + 1; block <= endBlock; block++ {
-		if err = s.indexBlock(block); err != nil {
+		if err = s.indexBlock(s.newOrm(), block); err != nil {
 			return
 		}
-		if dictKey != "" {
-			obj := &models.Dict{}
-			if _, err = _orm.Update(_m.Bind(obj).Update("Value", block).Where("Key", dictKey)); err != nil {
+		if saveDict {
+			if err = s.saveLastBlock(block); err != nil {
 				return
 			}
 		}
@@ -87,44 +90,91 @@ func (s *Indexer) Run(startBlock, endBlock int64, minConfirmation int) (err erro
 	return
 }
 
-func (s *Indexer) indexBlock(block int64) (err error) {
+// Next indexes the block after the last indexed one if it has enough confirmations, ok is false if there is none.
+func (s *Indexer) Next(minConfirmation int) (block int64, ok bool, err error) {
+	var lastBlock, confirmedBlock int64
+	if lastBlock, err = s.lastBlock(); err != nil {
+		return
+	}
+	if confirmedBlock, err = s.confirmedBlock(minConfirmation); err != nil || lastBlock >= confirmedBlock {
+		return
+	}
+	block = lastBlock + 1
+	if err = s.indexBlock(s.newOrm(), block); err != nil {
+		return
+	}
+	if err = s.saveLastBlock(block); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func (s *Indexer) dictKey() string {
+	return strings.ToLower(s.Chain) + ".ord.indexer.block"
+}
+
+// lastBlock: the last indexed block, which starts from the genesis block of ordinals.
+func (s *Indexer) lastBlock() (block int64, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	obj := &models.Dict{}
+	value, err := _orm.One(_m.Bind(obj).Where("Key", s.dictKey()), "value")
+	if err != nil {
+		return
+	}
+	block = conv.Int64(value)
+
+	if block <= 0 {
+		block = config.Instance().OrdGenesisBlock[strings.ToLower(s.Chain)]
+		obj := &models.Dict{Key: s.dictKey(), Value: conv.String(block)}
+		if _, _, err = _orm.Save(_m.Bind(obj).BatchData(obj)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Indexer) saveLastBlock(block int64) (err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	_, err = _orm.Update(_m.Bind(&models.Dict{}).Update("Value", block).Where("Key", s.dictKey()))
+	return
+}
+
+// confirmedBlock: the highest block with enough confirmations.
+func (s *Indexer) confirmedBlock(minConfirmation int) (block int64, err error) {
+	if block, err = s.btc().GetBlockNumber(); err != nil {
+		return
+	}
+	block = block - int64(minConfirmation)
+	return
+}
+
+// indexBlock: save the ord txs of the block through the orm, which may be bound to a transaction, see Reindex.
+func (s *Indexer) indexBlock(_orm *orm.Orm, block int64) (err error) {
 	log.Printf("indexing block:%d", block)
 	var info map[string]any
-	if info, err = s.Rpc.GetBlockByNumber(block, true); err != nil {
+	if info, err = s.btc().GetBlockByNumber(block, true); err != nil {
 		return
 	}
 
 	for txIdx, tx := range info["tx"].([]any) {
-		if err = s.indexTx(block, txIdx, tx, conv.Int64(info["time"])); err != nil {
+		if err = s.indexTx(_orm, block, txIdx, tx, conv.Int64(info["time"])); err != nil {
 			return
 		}
 	}
 	return
 }
 
-func (s *Indexer) indexTx(block int64, txIdx int, tx any, blockTime int64) (err error) {
-	_orm := &orm.Orm{Db: s.Db}
+func (s *Indexer) indexTx(_orm *orm.Orm, block int64, txIdx int, tx any, blockTime int64) (err error) {
 	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 	txMap := tx.(map[string]any)
 	txid := conv.String(txMap["txid"])
 	vins := txMap["vin"].([]any)
 	vouts := txMap["vout"].([]any)
 	for inputIdx, _vin := range vins {
-		vin := _vin.(map[string]any)
-		var hexList []string
-		if strings.EqualFold(s.Chain, "doge") {
-			if vin["scriptSig"] != nil {
-				hexList = append(hexList, conv.String(vin["scriptSig"].(map[string]any)["hex"]))
-			}
-		} else {
-			witness := vin["txinwitness"]
-			if witness != nil && len(witness.([]any)) >= 2 {
-				size := len(witness.([]any))
-				hexList = append(hexList, conv.String(witness.([]any)[size-2])) // for other taproot
-				hexList = append(hexList, conv.String(witness.([]any)[size-1])) // for taproot annex， TODO: maybe it's better to check the prefix of the annex here.
-			}
-		}
-		for _, hex := range hexList {
+		for _, hex := range s.envelopeHexes(_vin.(map[string]any)) {
 			meta, contents := s.parseOrd(txid, hex)
 			m := conv.Map(contents)
 			// To avoid issues with non-standard inscriptions in some wallets, we will reconfirm and record the problems.
@@ -163,9 +213,14 @@ func (s *Indexer) indexTx(block int64, txIdx int, tx any, blockTime int64) (err
 						DeployTime:     tx.BlockTime,
 						DeployPosition: txIdx,
 					}
-					// if duplication, db will ignore insert
-					if _, _, err = _orm.Save(_m.Bind(tick).BatchData(tick)); err != nil {
+					// A deploy indexed again, e.g: after a fix of the parser, overwrites its tick, the later deploys of the tick are ignored.
+					var deployed *models.Tick
+					if deployed, err = orm.First[*models.Tick](_orm, _m.Bind(&models.Tick{}).Where("Name", tick.Name)); err != nil {
 						return
+					} else if deployed == nil || deployed.DeployTx == txid {
+						if _, _, err = _orm.Save(_m.Bind(tick).BatchData(tick).Upsert("Name").Overwrite("Dec", "Supply", "MintLimit", "DeployAddress", "DeployTime", "DeployPosition")); err != nil {
+							return
+						}
 					}
 				}
 
@@ -187,13 +242,11 @@ func (s *Indexer) indexTx(block int64, txIdx int, tx any, blockTime int64) (err
 			continue
 		}
 		// Determine if the previous transaction is a inscribe-transfer transaction.
-		obj := &models.Tx{}
-		var item any
-		if item, err = _orm.One(_m.Bind(obj).Where("TxId", prevTxID).Where("Operation", "inscribe-transfer"), ""); err != nil {
+		var obj *models.Tx
+		if obj, err = orm.First[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", prevTxID).Where("Operation", "inscribe-transfer")); err != nil {
 			return
-		} else if item != nil {
-			obj = item.(*models.Tx)
-			toAddress, outputIdx, satOffset, _err := s.calReceiveAddress(obj.SatOffset, idx, inputIdx2ValueMap, vins, vouts)
+		} else if obj != nil {
+			toAddress, outputIdx, satOffset, _err := s.calReceiveAddress(obj.SatOffset, idx, inputIdx2ValueMap, vins, vouts, nil)
 			if _err != nil {
 				err = _err
 				return
@@ -221,6 +274,23 @@ func (s *Indexer) indexTx(block int64, txIdx int, tx any, blockTime int64) (err
 	return
 }
 
+// envelopeHexes: the scripts of the input which may contain an ord envelope.
+func (s *Indexer) envelopeHexes(vin map[string]any) (hexList []string) {
+	if strings.EqualFold(s.Chain, "doge") {
+		if vin["scriptSig"] != nil {
+			hexList = append(hexList, conv.String(vin["scriptSig"].(map[string]any)["hex"]))
+		}
+	} else {
+		witness := vin["txinwitness"]
+		if witness != nil && len(witness.([]any)) >= 2 {
+			size := len(witness.([]any))
+			hexList = append(hexList, conv.String(witness.([]any)[size-2])) // for other taproot
+			hexList = append(hexList, conv.String(witness.([]any)[size-1])) // for taproot annex， TODO: maybe it's better to check the prefix of the annex here.
+		}
+	}
+	return
+}
+
 func (s *Indexer) parseOrd(txid, hex string) (meta string, contents []byte) {
 	protocol := protocols[strings.ToLower(s.Chain)]
 	_bytes := hexutils.HexToBytes(hex)
@@ -324,7 +394,7 @@ func (s *Indexer) getInputValue(vin map[string]any) (value string, err error) {
 		return
 	}
 	var tx map[string]any
-	if tx, err = s.Rpc.GetTransactionByHash(conv.String(vin["txid"])); err != nil {
+	if tx, err = s.btc().GetTransactionByHash(conv.String(vin["txid"])); err != nil {
 		return
 	}
 	if tx != nil {
@@ -344,7 +414,7 @@ func (s *Indexer) getInputAddress(vin map[string]any) (address string, err error
 		return
 	}
 	var tx map[string]any
-	if tx, err = s.Rpc.GetTransactionByHash(conv.String(vin["txid"])); err != nil {
+	if tx, err = s.btc().GetTransactionByHash(conv.String(vin["txid"])); err != nil {
 		return
 	}
 	if tx != nil {
@@ -357,7 +427,8 @@ func (s *Indexer) getInputAddress(vin map[string]any) (address string, err error
 	return
 }
 
-func (s *Indexer) calReceiveAddress(prevSatOffset string, currentInputIdx int, inputIdx2ValueMap map[int]string, vins, vouts []any) (to string, outputIdx int, satOffset string, err error) {
+// calReceiveAddress: track the inscribed sat from the input to the output, the steps are recorded into path if it's not nil.
+func (s *Indexer) calReceiveAddress(prevSatOffset string, currentInputIdx int, inputIdx2ValueMap map[int]string, vins, vouts []any, path *SatPath) (to string, outputIdx int, satOffset string, err error) {
 	if len(vins) == 0 || len(vouts) == 0 {
 		return
 	}
@@ -422,5 +493,123 @@ func (s *Indexer) calReceiveAddress(prevSatOffset string, currentInputIdx int, i
 			break
 		}
 	}
+	if path != nil {
+		path.InputIndex, path.PrevSatOffset = currentInputIdx, prevSatOffset
+		path.InputOffset, path.InputEnd = inputOffset, inputEnd
+		path.InputTotal, path.OutputTotal, path.Fee = inputTotalAmount.IntPart(), outputTotalAmount.IntPart(), fee.IntPart()
+		for idx := range vouts {
+			path.Outputs = append(path.Outputs, &SatOutput{
+				Address: s.getOutputAddress(vouts[idx].(map[string]any)),
+				Offset:  output2OffsetMap[idx],
+				Value:   conv.Decimal(vouts[idx].(map[string]any)["value"]).Shift(8).IntPart(),
+				IsFee:   fee.GreaterThan(decimal.Zero) && idx == len(vouts)-1,
+			})
+		}
+		path.OutputIndex, path.SatOffset, path.To = outputIdx, satOffset, to
+	}
+	return
+}
+
+// Rollback deletes the txs indexed after the block and the ticks deployed by them, so that they can be indexed again.
+// The validation of the blocks must have been rolled back before, see validator.Rollback.
+func (s *Indexer) Rollback(block int64) (err error) {
+	if validatorBlock, _err := s.validatorBlock(); _err != nil {
+		err = _err
+		return
+	} else if validatorBlock > block {
+		err = errors.Errorf("block:%d has been validated, please roll back the validator first", validatorBlock)
+		return
+	}
+	var lastBlock int64
+	if lastBlock, err = s.lastBlock(); err != nil {
+		return
+	}
+	prefix := strings.ToLower(s.Chain) + "_"
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{fmt.Sprintf("delete from %[1]sord_tick where deploy_tx in (select txid from %[1]sord_tx where op='deploy' and block_height>?)", prefix), []any{block}},
+		{fmt.Sprintf("delete from %sord_tx where block_height>?", prefix), []any{block}},
+	}
+	if lastBlock > block {
+		statements = append(statements, struct {
+			query string
+			args  []any
+		}{fmt.Sprintf("update %sord_dict set value=? where `key`=?", prefix), []any{conv.String(block), s.dictKey()}})
+	}
+	dialect := orm.DialectOf(s.Db)
+	tx, err := s.Db.BeginTx(s.context(), nil)
+	if err != nil {
+		return
+	}
+	for _, statement := range statements {
+		if _, err = tx.ExecContext(s.context(), dialect.Rebind(statement.query), statement.args...); err != nil {
+			_ = tx.Rollback()
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	log.Printf("rolled back indexed blocks to %d", block)
+	return
+}
+
+// Reindex deletes the txs of the block and the ticks deployed by them, and indexes the block again in one transaction,
+// so the block is kept as it was if the reindex fails.
+// The block must have been indexed but not validated, otherwise the validation of it should be rolled back first.
+func (s *Indexer) Reindex(block int64) (err error) {
+	var lastBlock int64
+	if lastBlock, err = s.lastBlock(); err != nil {
+		return
+	}
+	if block > lastBlock {
+		err = errors.Errorf("block:%d has not been indexed yet, the last indexed block is %d", block, lastBlock)
+		return
+	}
+	if validatorBlock, _err := s.validatorBlock(); _err != nil {
+		err = _err
+		return
+	} else if validatorBlock >= block {
+		err = errors.Errorf("block:%d has been validated, please roll back to block:%d first", block, block-1)
+		return
+	}
+	prefix := strings.ToLower(s.Chain) + "_"
+	tx, err := s.Db.BeginTx(s.context(), nil)
+	if err != nil {
+		return
+	}
+	if _, err = tx.ExecContext(s.context(), orm.DialectOf(s.Db).Rebind(fmt.Sprintf("delete from %[1]sord_tick where deploy_tx in (select txid from %[1]sord_tx where op='deploy' and block_height=?)", prefix)), block); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	_orm := s.newOrm()
+	_orm.Tx = tx
+	_m := &orm.Model{TablePrefix: prefix}
+	if _, err = _orm.Delete(_m.Bind(&models.Tx{}).Where("BlockHeight", block)); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if err = s.indexBlock(_orm, block); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	log.Printf("reindexed block:%d", block)
+	return
+}
+
+// validatorBlock: the last validated block.
+func (s *Indexer) validatorBlock() (block int64, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var value any
+	if value, err = _orm.One(_m.Bind(&models.Dict{}).Where("Key", strings.ToLower(s.Chain)+".ord.validator.block"), "value"); err != nil {
+		return
+	}
+	block = conv.Int64(value)
 	return
 }
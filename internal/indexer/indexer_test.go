@@ -1,10 +1,21 @@
 package indexer
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"libord/internal/migrate"
+	"libord/internal/models"
 	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"libord/pkg/rpc"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
 func Test_ParseBtcOrd(t *testing.T) {
@@ -123,3 +134,111 @@ func Test_ParseDogeOrd(t *testing.T) {
 	assert.EqualValues(t, m["tick"], "dogi")
 	assert.EqualValues(t, m["amt"], "50")
 }
+
+func Test_Rollback(t *testing.T) {
+	_db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	defer _db.Close()
+	_db.SetMaxOpenConns(1)
+	_, err = (&migrate.Migrator{Chain: "btc", Db: _db}).Up()
+	assert.Nil(t, err)
+
+	// A tick is deployed at every block from 100 to 103.
+	_orm := &orm.Orm{Db: _db}
+	for block := int64(100); block <= 103; block++ {
+		txid := fmt.Sprintf("%064d", block)
+		tick := &models.Tick{Name: fmt.Sprintf("t%d", block), DeployTx: txid}
+		_, _, err = _orm.Save((&orm.Model{TablePrefix: "btc_"}).Bind(tick).BatchData(tick))
+		assert.Nil(t, err)
+		tx := &models.Tx{TxId: txid, Operation: "deploy", Tick: tick.Name, BlockHeight: block}
+		_, _, err = _orm.Save((&orm.Model{TablePrefix: "btc_"}).Bind(tx).BatchData(tx))
+		assert.Nil(t, err)
+	}
+	dict := &models.Dict{Key: "btc.ord.validator.block", Value: "102"}
+	_, _, err = _orm.Save((&orm.Model{TablePrefix: "btc_"}).Bind(dict).BatchData(dict, &models.Dict{Key: "btc.ord.indexer.block", Value: "103"}))
+	assert.Nil(t, err)
+
+	_indexer := &Indexer{Chain: "btc", Db: _db}
+	assert.NotNil(t, _indexer.Rollback(101))
+	assert.Nil(t, _indexer.Rollback(102))
+	last, err := _indexer.lastBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(102), last)
+	count, err := orm.Count(_orm, (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tick{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+	count, err = orm.Count(_orm, (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tx{}).WhereGT("BlockHeight", 102))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// A rollback after the last indexed block keeps the checkpoint.
+	assert.Nil(t, _indexer.Rollback(110))
+	last, err = _indexer.lastBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(102), last)
+
+	// The checkpoint of the validator can't be read, e.g: the table is gone.
+	_, err = _db.Exec("drop table btc_ord_dict")
+	assert.Nil(t, err)
+	assert.NotNil(t, _indexer.Rollback(110))
+}
+
+func Test_Reindex(t *testing.T) {
+	_db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	defer _db.Close()
+	_db.SetMaxOpenConns(1)
+	_, err = (&migrate.Migrator{Chain: "btc", Db: _db}).Up()
+	assert.Nil(t, err)
+	_orm := &orm.Orm{Db: _db}
+	inscribe := &models.Tx{TxId: "i1", InscriptionId: "i1i0", Operation: "inscribe-transfer", Tick: "ordi", Amount: "1", To: "bc1qa", SatOffset: "0,10000", BlockHeight: 102}
+	_, _, err = _orm.Save((&orm.Model{TablePrefix: "btc_"}).Bind(inscribe).BatchData(inscribe, &models.Tx{TxId: "t0", Operation: "transfer", Tick: "ordi", BlockHeight: 103}))
+	assert.Nil(t, err)
+	dict := &models.Dict{Key: "btc.ord.indexer.block", Value: "103"}
+	_, _, err = _orm.Save((&orm.Model{TablePrefix: "btc_"}).Bind(dict).BatchData(dict, &models.Dict{Key: "btc.ord.validator.block", Value: "102"}))
+	assert.Nil(t, err)
+
+	// The block spends the inscribed sat to bc1qz, the value of the input of t2 can't be fetched if fail is set.
+	fail := true
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		var result any
+		switch req["method"] {
+		case "getblockhash":
+			result = "hash"
+		case "getblock":
+			txs := []any{map[string]any{"txid": "t1",
+				"vin":  []any{map[string]any{"txid": "i1", "vout": 0, "prevout": map[string]any{"value": 0.0001, "scriptPubKey": map[string]any{"address": "bc1qa"}}}},
+				"vout": []any{map[string]any{"value": 0.0001, "scriptPubKey": map[string]any{"address": "bc1qz"}}}}}
+			if fail {
+				txs = append(txs, map[string]any{"txid": "t2", "vin": []any{map[string]any{"txid": "i1", "vout": 0}}, "vout": []any{map[string]any{"value": 0.0001}}})
+			}
+			result = map[string]any{"time": 1700000000, "tx": txs}
+		case "getrawtransaction":
+			result = map[string]any{"txid": "other"}
+		}
+		_, _ = w.Write([]byte(conv.String(map[string]any{"id": "1", "result": result})))
+	}))
+	defer node.Close()
+	_indexer := &Indexer{Chain: "btc", Db: _db, Rpc: &rpc.Btc{Chain: "btc", Url: node.URL}}
+	txids := func() []string {
+		ids, err := orm.Pluck[string](_orm, (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tx{}).Where("BlockHeight", 103).OrderBy("Id"), "TxId")
+		assert.Nil(t, err)
+		return ids
+	}
+
+	assert.NotNil(t, _indexer.Reindex(102))
+	// The block is kept as it was if the reindex fails halfway.
+	err = _indexer.Reindex(103)
+	assert.ErrorContains(t, err, "not match hash")
+	assert.Equal(t, []string{"t0"}, txids())
+
+	fail = false
+	assert.Nil(t, _indexer.Reindex(103))
+	assert.Equal(t, []string{"t1"}, txids())
+	transfer, err := orm.First[*models.Tx](_orm, (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tx{}).Where("TxId", "t1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bc1qz", transfer.To)
+	assert.Equal(t, "i1i0", transfer.InscriptionId)
+}
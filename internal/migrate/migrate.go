@@ -0,0 +1,299 @@
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The migrations of every dialect, e.g: migrations/mysql/0002_add_column.up.sql and 0002_add_column.down.sql.
+// The tables are written as {prefix}ord_tx, the prefix of the chain is filled in when they are applied.
+//
+//go:embed migrations
+var files embed.FS
+
+// versionTable keeps the applied migrations of every chain prefix, it's shared by all the chains.
+const versionTable = "schema_version"
+
+// Migration is a version of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied to the chain, zero if not yet.
+type Status struct {
+	*Migration
+	ApplyTime int64
+}
+
+func (s *Status) String() string {
+	applied := "pending"
+	if s.ApplyTime > 0 {
+		applied = "applied at " + time.Unix(s.ApplyTime, 0).Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%04d_%s: %s", s.Version, s.Name, applied)
+}
+
+// Migrations: the migrations of the dialect in the order of their versions.
+func Migrations(dialect orm.Dialect) (ret []*Migration, err error) {
+	dir := path.Join("migrations", dialect.Name())
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	versions := make(map[int]*Migration)
+	for _, entry := range entries {
+		var version int
+		var name, direction string
+		// e.g: 0001_init.up.sql
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		if i := strings.LastIndex(base, "."); i > 0 {
+			direction = base[i+1:]
+			base = base[:i]
+		}
+		if i := strings.Index(base, "_"); i > 0 {
+			version, name = int(conv.Int64(base[:i])), base[i+1:]
+		}
+		if version <= 0 || (direction != "up" && direction != "down") {
+			err = errors.Errorf("bad migration file name:%s/%s", dir, entry.Name())
+			return
+		}
+		var content []byte
+		if content, err = files.ReadFile(path.Join(dir, entry.Name())); err != nil {
+			return
+		}
+		migration := versions[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			versions[version] = migration
+			ret = append(ret, migration)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	for i, migration := range ret {
+		if migration.Version != i+1 {
+			err = errors.Errorf("migration version:%d of %s is missing", i+1, dialect.Name())
+			return
+		} else if migration.Up == "" || migration.Down == "" {
+			err = errors.Errorf("migration:%04d_%s of %s has no up or down", migration.Version, migration.Name, dialect.Name())
+			return
+		}
+	}
+	return
+}
+
+// statements splits the migration into the statements of the chain by the semicolons which are not quoted or commented,
+// the comments are dropped.
+func statements(migration, prefix string) (ret []string) {
+	var b strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(b.String()); statement != "" {
+			ret = append(ret, strings.ReplaceAll(statement, "{prefix}", prefix))
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(migration); i++ {
+		c := migration[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`': // a quote ends at the same quote, a doubled quote is taken as two quotes
+			end := len(migration) - 1
+			if j := strings.IndexByte(migration[i+1:], c); j >= 0 {
+				end = i + 1 + j
+			}
+			b.WriteString(migration[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(migration[i:], "--"):
+			if j := strings.IndexByte(migration[i:], '\n'); j < 0 {
+				i = len(migration)
+			} else {
+				i += j - 1
+			}
+		case c == '/' && strings.HasPrefix(migration[i:], "/*"):
+			if j := strings.Index(migration[i+2:], "*/"); j < 0 {
+				i = len(migration)
+			} else {
+				i += j + 3
+			}
+			b.WriteByte(' ')
+		case c == ';':
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return
+}
+
+// Migrator applies the migrations to the tables of a chain.
+type Migrator struct {
+	Chain string
+	Db    *sql.DB
+}
+
+func (s *Migrator) prefix() string {
+	return strings.ToLower(s.Chain) + "_"
+}
+
+func (s *Migrator) dialect() orm.Dialect {
+	return orm.DialectOf(s.Db)
+}
+
+func (s *Migrator) createVersionTable() (err error) {
+	_, err = s.Db.Exec("create table if not exists " + versionTable + " (prefix varchar(20) not null, version int not null, name varchar(100) not null, apply_time bigint not null, primary key (prefix, version))")
+	return
+}
+
+// applied: the apply time of the applied versions.
+func (s *Migrator) applied() (ret map[int]int64, err error) {
+	if err = s.createVersionTable(); err != nil {
+		return
+	}
+	_orm := &orm.Orm{Db: s.Db}
+	var items []any
+	if items, err = _orm.Find((&orm.Model{}).Extra("select version,apply_time from "+versionTable+" where prefix=?", s.prefix())); err != nil {
+		return
+	}
+	ret = make(map[int]int64)
+	for _, item := range items {
+		m := item.(map[string]any)
+		ret[int(conv.Int64(m["version"]))] = conv.Int64(m["apply_time"])
+	}
+	return
+}
+
+// Version: the latest applied version of the schema of the chain, 0 if none.
+func (s *Migrator) Version() (version int, err error) {
+	var applied map[int]int64
+	if applied, err = s.applied(); err != nil {
+		return
+	}
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return
+}
+
+// Status: every migration and whether it has been applied to the chain.
+func (s *Migrator) Status() (ret []*Status, err error) {
+	var migrations []*Migration
+	if migrations, err = Migrations(s.dialect()); err != nil {
+		return
+	}
+	var applied map[int]int64
+	if applied, err = s.applied(); err != nil {
+		return
+	}
+	for _, migration := range migrations {
+		ret = append(ret, &Status{Migration: migration, ApplyTime: applied[migration.Version]})
+	}
+	return
+}
+
+// Up applies the migrations after the current version in order, and returns those applied.
+func (s *Migrator) Up() (ret []*Migration, err error) {
+	var migrations []*Migration
+	if migrations, err = Migrations(s.dialect()); err != nil {
+		return
+	}
+	var version int
+	if version, err = s.Version(); err != nil {
+		return
+	}
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err = s.apply(migration.Up, "insert into "+versionTable+"(prefix,version,name,apply_time) values(?,?,?,?)", s.prefix(), migration.Version, migration.Name, time.Now().Unix()); err != nil {
+			err = errors.Wrapf(err, "migrate %s up to %04d_%s", s.Chain, migration.Version, migration.Name)
+			return
+		}
+		ret = append(ret, migration)
+	}
+	return
+}
+
+// Down reverts the current version, and returns the migration reverted, nil if no migration has been applied.
+// The baseline migration is only reverted if force is set, as it drops all the tables of the chain.
+func (s *Migrator) Down(force bool) (ret *Migration, err error) {
+	var migrations []*Migration
+	if migrations, err = Migrations(s.dialect()); err != nil {
+		return
+	}
+	var version int
+	if version, err = s.Version(); err != nil || version == 0 {
+		return
+	} else if version > len(migrations) {
+		err = errors.Errorf("the schema of %s is at version:%d, which is newer than the migrations of this binary", s.Chain, version)
+		return
+	}
+	migration := migrations[version-1]
+	if migration.Version == 1 && !force {
+		err = errors.Errorf("reverting the baseline migration %04d_%s drops all the tables of %s, please run with --force to do it", migration.Version, migration.Name, s.Chain)
+		return
+	}
+	if err = s.apply(migration.Down, "delete from "+versionTable+" where prefix=? and version=?", s.prefix(), migration.Version); err != nil {
+		err = errors.Wrapf(err, "migrate %s down from %04d_%s", s.Chain, migration.Version, migration.Name)
+		return
+	}
+	ret = migration
+	return
+}
+
+// apply runs the migration and records it in one transaction. MySQL commits the DDL statements implicitly though,
+// so the migrations are written to be run again if the record fails.
+func (s *Migrator) apply(migration string, record string, args ...any) (err error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return
+	}
+	for _, statement := range statements(migration, s.prefix()) {
+		if _, err = tx.Exec(statement); err != nil {
+			_ = tx.Rollback()
+			return
+		}
+	}
+	if _, err = tx.Exec(s.dialect().Rebind(record), args...); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// Check returns an error if the schema of the chain isn't at the latest version of the migrations.
+func (s *Migrator) Check() (err error) {
+	var migrations []*Migration
+	if migrations, err = Migrations(s.dialect()); err != nil {
+		return
+	}
+	var version int
+	if version, err = s.Version(); err != nil {
+		return
+	}
+	if latest := len(migrations); version < latest {
+		err = errors.Errorf("the schema of %s is at version:%d, version:%d is required, please run: ord-indexer migrate up", s.Chain, version, latest)
+	} else if version > latest {
+		err = errors.Errorf("the schema of %s is at version:%d, which is newer than version:%d of this binary", s.Chain, version, latest)
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func Test_Migrate(t *testing.T) {
+	_db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	defer _db.Close()
+
+	btc := &Migrator{Chain: "btc", Db: _db}
+	ltc := &Migrator{Chain: "ltc", Db: _db}
+	assert.NotNil(t, btc.Check())
+
+	applied, err := btc.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(applied))
+	assert.Equal(t, 1, applied[0].Version)
+	assert.Nil(t, btc.Check())
+	assert.NotNil(t, ltc.Check())
+	_, err = _db.Exec("insert into btc_ord_dict(`key`,value) values('btc.ord.indexer.block','1')")
+	assert.Nil(t, err)
+
+	// Up again is a no-op.
+	applied, err = btc.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(applied))
+
+	status, err := btc.Status()
+	assert.Nil(t, err)
+	assert.Greater(t, status[0].ApplyTime, int64(0))
+	status, err = ltc.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), status[0].ApplyTime)
+
+	// The txs patched by hand are copied into ord_patch.
+	reverted, err := btc.Down(false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, reverted.Version)
+	_, err = _db.Exec("insert into btc_ord_tx(txid,op,input_idx,tick,block_height,status,valid_amt,reason) values('a','transfer',0,'ordi',100,2,'','patch:stolen'),('b','mint',0,'ordi',100,1,'','')")
+	assert.Nil(t, err)
+	applied, err = btc.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(applied))
+	var txid, reason string
+	var patchStatus, count int
+	assert.Nil(t, _db.QueryRow("select txid,status,reason from btc_ord_patch").Scan(&txid, &patchStatus, &reason))
+	assert.Equal(t, []any{"a", 2, "stolen"}, []any{txid, patchStatus, reason})
+	reverted, err = btc.Down(false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, reverted.Version)
+	assert.Nil(t, _db.QueryRow("select count(*) from btc_ord_patch").Scan(&count))
+	assert.Equal(t, 0, count)
+
+	reverted, err = btc.Down(false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reverted.Version)
+	_, err = _db.Exec("select * from btc_ord_tick_shadow")
+	assert.NotNil(t, err)
+
+	// The baseline is only reverted by force.
+	_, err = btc.Down(false)
+	assert.NotNil(t, err)
+	_, err = _db.Exec("select * from btc_ord_dict")
+	assert.Nil(t, err)
+	reverted, err = btc.Down(true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reverted.Version)
+	version, err := btc.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+	_, err = _db.Exec("select * from btc_ord_dict")
+	assert.NotNil(t, err)
+
+	reverted, err = btc.Down(true)
+	assert.Nil(t, err)
+	assert.Nil(t, reverted)
+}
+
+func Test_Statements(t *testing.T) {
+	ret := statements("-- comment\nCREATE TABLE {prefix}ord_dict (id int);\n\nCREATE INDEX {prefix}a ON {prefix}ord_dict (id);\n", "doge_")
+	assert.Equal(t, []string{"CREATE TABLE doge_ord_dict (id int)", "CREATE INDEX doge_a ON doge_ord_dict (id)"}, ret)
+
+	ret = statements("INSERT INTO {prefix}ord_dict VALUES ('a;b', \"c;\"); -- the end; of a\n/* block; comment */ UPDATE t SET `v;`='it''s;' -- x;", "btc_")
+	assert.Equal(t, []string{`INSERT INTO btc_ord_dict VALUES ('a;b', "c;")`, "UPDATE t SET `v;`='it''s;'"}, ret)
+}
@@ -1,23 +1,7 @@
-CREATE TABLE `ord_dict` (
-  `id` int unsigned NOT NULL AUTO_INCREMENT,
-  `key` varchar(100) DEFAULT NULL,
-  `value` text,
-  PRIMARY KEY (`id`),
-  UNIQUE KEY `uni-key` (`key`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+-- The shadow tables of the ticks, addresses and balance events revalidated by the validator, which are swapped into the live
+-- tables afterwards. They were created by "create table ... like" of MySQL before, the columns must follow the live tables.
 
-CREATE TABLE `ord_address` (
-  `id` int unsigned NOT NULL AUTO_INCREMENT,
-  `address` varchar(100) DEFAULT NULL,
-  `tick` varchar(100) DEFAULT NULL,
-  `available` varchar(100) DEFAULT NULL,
-  `transferable` varchar(100) DEFAULT NULL,
-  `block` int unsigned DEFAULT NULL,
-  PRIMARY KEY (`id`),
-  UNIQUE KEY `uni-addr-tick` (`address`,`tick`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-
-CREATE TABLE `ord_tick` (
+CREATE TABLE IF NOT EXISTS `{prefix}ord_tick_shadow` (
   `id` int unsigned NOT NULL AUTO_INCREMENT,
   `name` varchar(100) DEFAULT NULL,
   `dec` int DEFAULT NULL,
@@ -35,27 +19,31 @@ CREATE TABLE `ord_tick` (
   UNIQUE KEY `uni-name` (`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-CREATE TABLE `ord_tx` (
+CREATE TABLE IF NOT EXISTS `{prefix}ord_address_shadow` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `address` varchar(100) DEFAULT NULL,
+  `tick` varchar(100) DEFAULT NULL,
+  `available` varchar(100) DEFAULT NULL,
+  `transferable` varchar(100) DEFAULT NULL,
+  `block` int unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uni-addr-tick` (`address`,`tick`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `{prefix}ord_balance_event_shadow` (
   `id` bigint unsigned NOT NULL AUTO_INCREMENT,
   `txid` varchar(100) DEFAULT NULL,
-  `inscription_id` varchar(100) DEFAULT NULL,
   `op` varchar(100) DEFAULT NULL,
+  `input_idx` int DEFAULT NULL,
+  `address` varchar(100) DEFAULT NULL,
   `tick` varchar(100) DEFAULT NULL,
-  `amt` varchar(100) DEFAULT NULL,
-  `valid_amt` varchar(100) DEFAULT NULL,
-  `from` varchar(100) DEFAULT NULL,
-  `to` varchar(100) DEFAULT NULL,
-  `sat_offset` varchar(100) DEFAULT NULL,
-  `block_height` int unsigned DEFAULT NULL,
-  `block_time` int unsigned DEFAULT NULL,
+  `available_delta` varchar(100) DEFAULT NULL,
+  `transferable_delta` varchar(100) DEFAULT NULL,
+  `available` varchar(100) DEFAULT NULL,
+  `transferable` varchar(100) DEFAULT NULL,
+  `block` int unsigned DEFAULT NULL,
   `pos` int DEFAULT NULL,
-  `input_idx` int DEFAULT NULL,
-  `output_idx` int DEFAULT NULL,
-  `status` int DEFAULT NULL,
-  `reason` varchar(255) DEFAULT NULL,
-  `meta` varchar(255) DEFAULT NULL,
-  `content` text,
   PRIMARY KEY (`id`),
-  UNIQUE KEY `uni-tx-op-idx` (`txid`,`op`,`input_idx`),
-  KEY `idx-block-pos-input` (`block_height`,`pos`,`input_idx`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
+  UNIQUE KEY `uni-tx-op-idx-addr` (`txid`,`op`,`input_idx`,`address`),
+  KEY `idx-block` (`block`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+DELETE FROM `{prefix}ord_patch` WHERE author = 'migration';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS {prefix}ord_patch;
+DROP TABLE IF EXISTS {prefix}ord_tx_shadow;
+DROP TABLE IF EXISTS {prefix}ord_balance_snapshot;
+DROP TABLE IF EXISTS {prefix}ord_balance_event;
+DROP TABLE IF EXISTS {prefix}ord_block_hash;
+DROP TABLE IF EXISTS {prefix}ord_tx;
+DROP TABLE IF EXISTS {prefix}ord_tick;
+DROP TABLE IF EXISTS {prefix}ord_address;
+DROP TABLE IF EXISTS {prefix}ord_dict;
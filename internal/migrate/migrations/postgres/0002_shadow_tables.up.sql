@@ -0,0 +1,46 @@
+-- The shadow tables of the ticks, addresses and balance events revalidated by the validator, which are swapped into the live
+-- tables afterwards. They were created by "create table ... like" of MySQL before, the columns must follow the live tables.
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_tick_shadow (
+  id serial PRIMARY KEY,
+  name varchar(100) DEFAULT NULL,
+  "dec" int DEFAULT NULL,
+  supply varchar(100) DEFAULT NULL,
+  mint_limit varchar(100) DEFAULT NULL,
+  minted varchar(100) DEFAULT NULL,
+  deploy_tx varchar(100) DEFAULT NULL,
+  deploy_pos int DEFAULT NULL,
+  deploy_by varchar(100) DEFAULT NULL,
+  deploy_time bigint DEFAULT NULL,
+  finish_mint_time bigint DEFAULT NULL,
+  finish_mint_tx varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_address_shadow (
+  id serial PRIMARY KEY,
+  address varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  available varchar(100) DEFAULT NULL,
+  transferable varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  UNIQUE (address, tick)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_balance_event_shadow (
+  id bigserial PRIMARY KEY,
+  txid varchar(100) DEFAULT NULL,
+  op varchar(100) DEFAULT NULL,
+  input_idx int DEFAULT NULL,
+  address varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  available_delta varchar(100) DEFAULT NULL,
+  transferable_delta varchar(100) DEFAULT NULL,
+  available varchar(100) DEFAULT NULL,
+  transferable varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  pos int DEFAULT NULL,
+  UNIQUE (txid, op, input_idx, address)
+);
+CREATE INDEX IF NOT EXISTS {prefix}ord_balance_event_shadow_block_idx ON {prefix}ord_balance_event_shadow (block);
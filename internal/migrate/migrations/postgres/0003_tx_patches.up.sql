@@ -0,0 +1,8 @@
+-- The txs patched by hand before ord_patch was kept, i.e., whose reason starts with "patch:", are copied into ord_patch,
+-- the validator only forces the results of the txs patched there.
+
+INSERT INTO {prefix}ord_patch (txid, op, input_idx, tick, block, status, valid_amt, reason, author, create_time)
+SELECT x.txid, x.op, x.input_idx, x.tick, x.block_height, CASE WHEN x.status = 2 THEN 2 ELSE 1 END, x.valid_amt, substr(x.reason, 7), 'migration', CAST(EXTRACT(EPOCH FROM NOW()) AS bigint)
+FROM {prefix}ord_tx x
+WHERE x.reason LIKE 'patch:%'
+  AND NOT EXISTS (SELECT 1 FROM {prefix}ord_patch p WHERE p.txid = x.txid AND p.op = x.op AND p.input_idx = x.input_idx);
@@ -0,0 +1,121 @@
+-- The tables are only created if missing, so that the databases created by hand from the former scripts/ddl*.sql are taken as version 1.
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_dict (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  `key` varchar(100) DEFAULT NULL,
+  value text,
+  UNIQUE (`key`)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_address (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  address varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  available varchar(100) DEFAULT NULL,
+  transferable varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  UNIQUE (address, tick)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_tick (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  name varchar(100) DEFAULT NULL,
+  `dec` int DEFAULT NULL,
+  supply varchar(100) DEFAULT NULL,
+  mint_limit varchar(100) DEFAULT NULL,
+  minted varchar(100) DEFAULT NULL,
+  deploy_tx varchar(100) DEFAULT NULL,
+  deploy_pos int DEFAULT NULL,
+  deploy_by varchar(100) DEFAULT NULL,
+  deploy_time bigint DEFAULT NULL,
+  finish_mint_time bigint DEFAULT NULL,
+  finish_mint_tx varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_tx (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  txid varchar(100) DEFAULT NULL,
+  inscription_id varchar(100) DEFAULT NULL,
+  op varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  amt varchar(100) DEFAULT NULL,
+  valid_amt varchar(100) DEFAULT NULL,
+  `from` varchar(100) DEFAULT NULL,
+  `to` varchar(100) DEFAULT NULL,
+  sat_offset varchar(100) DEFAULT NULL,
+  block_height bigint DEFAULT NULL,
+  block_time bigint DEFAULT NULL,
+  pos int DEFAULT NULL,
+  input_idx int DEFAULT NULL,
+  output_idx int DEFAULT NULL,
+  status int DEFAULT NULL,
+  reason varchar(255) DEFAULT NULL,
+  meta varchar(255) DEFAULT NULL,
+  content text,
+  UNIQUE (txid, op, input_idx)
+);
+CREATE INDEX IF NOT EXISTS {prefix}ord_tx_block_height_pos_input_idx ON {prefix}ord_tx (block_height, pos, input_idx);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_block_hash (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  block bigint DEFAULT NULL,
+  hash varchar(64) DEFAULT NULL,
+  prev_hash varchar(64) DEFAULT NULL,
+  UNIQUE (block)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_balance_event (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  txid varchar(100) DEFAULT NULL,
+  op varchar(100) DEFAULT NULL,
+  input_idx int DEFAULT NULL,
+  address varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  available_delta varchar(100) DEFAULT NULL,
+  transferable_delta varchar(100) DEFAULT NULL,
+  available varchar(100) DEFAULT NULL,
+  transferable varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  pos int DEFAULT NULL,
+  UNIQUE (txid, op, input_idx, address)
+);
+CREATE INDEX IF NOT EXISTS {prefix}ord_balance_event_tick_address_block ON {prefix}ord_balance_event (tick, address, block);
+CREATE INDEX IF NOT EXISTS {prefix}ord_balance_event_block ON {prefix}ord_balance_event (block);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_balance_snapshot (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  block bigint DEFAULT NULL,
+  address varchar(100) DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  available varchar(100) DEFAULT NULL,
+  transferable varchar(100) DEFAULT NULL,
+  UNIQUE (block, tick, address)
+);
+CREATE INDEX IF NOT EXISTS {prefix}ord_balance_snapshot_tick_address_block ON {prefix}ord_balance_snapshot (tick, address, block);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_tx_shadow (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  tx_row_id bigint DEFAULT NULL,
+  status int DEFAULT NULL,
+  reason varchar(255) DEFAULT NULL,
+  valid_amt varchar(100) DEFAULT NULL,
+  UNIQUE (tx_row_id)
+);
+
+CREATE TABLE IF NOT EXISTS {prefix}ord_patch (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  txid varchar(100) DEFAULT NULL,
+  op varchar(100) DEFAULT NULL,
+  input_idx int DEFAULT NULL,
+  tick varchar(100) DEFAULT NULL,
+  block bigint DEFAULT NULL,
+  status int DEFAULT NULL,
+  valid_amt varchar(100) DEFAULT NULL,
+  reason varchar(255) DEFAULT NULL,
+  author varchar(100) DEFAULT NULL,
+  create_time bigint DEFAULT NULL,
+  UNIQUE (txid, op, input_idx)
+);
+CREATE INDEX IF NOT EXISTS {prefix}ord_patch_block ON {prefix}ord_patch (block);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS {prefix}ord_balance_event_shadow;
+DROP TABLE IF EXISTS {prefix}ord_address_shadow;
+DROP TABLE IF EXISTS {prefix}ord_tick_shadow;
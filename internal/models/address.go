@@ -2,10 +2,10 @@ package models
 
 type Address struct {
 	meta          string `table:"ord_address"`
-	Id            int64  `json:"id"`
-	Address       string `json:"address"`
-	Tick          string `json:"tick"`
-	Available     string `json:"available"`
-	Transferable  string `json:"transferable"`
-	BlockAtUpdate int64  `json:"block"` // block height at last update balance
+	Id            int64  `db:"id,pk,autoincr" json:"id"`
+	Address       string `db:"address" json:"address"`
+	Tick          string `db:"tick" json:"tick"`
+	Available     string `db:"available" json:"available"`
+	Transferable  string `db:"transferable" json:"transferable"`
+	BlockAtUpdate int64  `db:"block" json:"block"` // block height at last update balance
 }
@@ -0,0 +1,18 @@
+package models
+
+// BalanceEvent is an append-only journal entry of a balance change, one row per address changed by a tx.
+type BalanceEvent struct {
+	meta              string `table:"ord_balance_event"`
+	Id                int64  `db:"id,pk,autoincr" json:"id"`
+	TxId              string `db:"txid" json:"txid"`
+	Operation         string `db:"op" json:"op"`
+	InputIndex        int    `db:"input_idx" json:"input_idx"` // together with txid and op, it's the unique key of the tx in ord_tx
+	Address           string `db:"address" json:"address"`
+	Tick              string `db:"tick" json:"tick"`
+	AvailableDelta    string `db:"available_delta" json:"available_delta"`
+	TransferableDelta string `db:"transferable_delta" json:"transferable_delta"`
+	Available         string `db:"available" json:"available"`       // available balance after the change
+	Transferable      string `db:"transferable" json:"transferable"` // transferable balance after the change
+	Block             int64  `db:"block" json:"block"`
+	Position          int    `db:"pos" json:"pos"` // the position of the tx in the block
+}
@@ -0,0 +1,13 @@
+package models
+
+// BalanceSnapshot is a copy of ord_address taken after a block, the balances at a later block are
+// the latest snapshot plus the balance events after it.
+type BalanceSnapshot struct {
+	meta         string `table:"ord_balance_snapshot"`
+	Id           int64  `db:"id,pk,autoincr" json:"id"`
+	Block        int64  `db:"block" json:"block"`
+	Address      string `db:"address" json:"address"`
+	Tick         string `db:"tick" json:"tick"`
+	Available    string `db:"available" json:"available"`
+	Transferable string `db:"transferable" json:"transferable"`
+}
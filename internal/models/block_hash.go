@@ -0,0 +1,9 @@
+package models
+
+type BlockHash struct {
+	meta     string `table:"ord_block_hash"`
+	Id       int64  `db:"id,pk,autoincr" json:"id"`
+	Block    int64  `db:"block" json:"block"`
+	Hash     string `db:"hash" json:"hash"`           // sha256 over prev_hash and the sorted balance and tick changes of this block
+	PrevHash string `db:"prev_hash" json:"prev_hash"` // hash of the previous block, empty at the start of the chain
+}
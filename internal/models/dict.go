@@ -2,7 +2,7 @@ package models
 
 type Dict struct {
 	meta  string `table:"ord_dict"`
-	Id    int64  `json:"id"`
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Id    int64  `db:"id,pk,autoincr" json:"id"`
+	Key   string `db:"key" json:"key"`
+	Value string `db:"value" json:"value"`
 }
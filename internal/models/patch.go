@@ -0,0 +1,17 @@
+package models
+
+// Patch forces the validation result of a tx, it's kept apart from ord_tx so that revalidation and reindexing don't lose it.
+type Patch struct {
+	meta        string   `table:"ord_patch"`
+	Id          int64    `db:"id,pk,autoincr" json:"id"`
+	TxId        string   `db:"txid" json:"txid"`
+	Operation   string   `db:"op" json:"op"`
+	InputIndex  int      `db:"input_idx" json:"input_idx"`
+	Tick        string   `db:"tick" json:"tick"`
+	Block       int64    `db:"block" json:"block"`         // block height of the tx
+	Status      TxStatus `db:"status" json:"status"`       // the forced status
+	ValidAmount string   `db:"valid_amt" json:"valid_amt"` // the forced valid amount, the amount of the tx is used if empty
+	Reason      string   `db:"reason" json:"reason"`       // why the tx is patched
+	Author      string   `db:"author" json:"author"`       // who patched the tx
+	CreateTime  int64    `db:"create_time" json:"create_time"`
+}
@@ -2,17 +2,17 @@ package models
 
 type Tick struct {
 	meta           string `table:"ord_tick"`
-	Id             int64  `json:"id"`
-	Name           string `json:"name"`
-	Dec            int    `json:"dec"`
-	Supply         string `json:"supply"`
-	MintLimit      string `json:"mint_limit"`
-	MintedAmount   string `json:"minted"`
-	DeployTx       string `json:"deploy_tx"`
-	DeployPosition int    `json:"deploy_pos"` // The position of the block where the transaction deploying this tick is located.
-	DeployAddress  string `json:"deploy_by"`
-	DeployTime     int64  `json:"deploy_time"`
-	FinishMintTx   string `json:"finish_mint_tx"`
-	FinishMintTime int64  `json:"finish_mint_time"`
-	BlockAtUpdate  int64  `json:"block"` // block height at last update
+	Id             int64  `db:"id,pk,autoincr" json:"id"`
+	Name           string `db:"name" json:"name"`
+	Dec            int    `db:"dec" json:"dec"`
+	Supply         string `db:"supply" json:"supply"`
+	MintLimit      string `db:"mint_limit" json:"mint_limit"`
+	MintedAmount   string `db:"minted" json:"minted"`
+	DeployTx       string `db:"deploy_tx" json:"deploy_tx"`
+	DeployPosition int    `db:"deploy_pos" json:"deploy_pos"` // The position of the block where the transaction deploying this tick is located.
+	DeployAddress  string `db:"deploy_by" json:"deploy_by"`
+	DeployTime     int64  `db:"deploy_time" json:"deploy_time"`
+	FinishMintTx   string `db:"finish_mint_tx" json:"finish_mint_tx"`
+	FinishMintTime int64  `db:"finish_mint_time" json:"finish_mint_time"`
+	BlockAtUpdate  int64  `db:"block" json:"block"` // block height at last update
 }
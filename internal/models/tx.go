@@ -10,23 +10,23 @@ const (
 
 type Tx struct {
 	meta          string   `table:"ord_tx"`
-	Id            int64    `json:"id"`
-	TxId          string   `json:"txid"`
-	InscriptionId string   `json:"inscription_id"`
-	Operation     string   `json:"op"`
-	Tick          string   `json:"tick"`
-	Amount        string   `json:"amt"`
-	ValidAmount   string   `json:"valid_amt"` // valid amount, If the total supply is 100 and 98 has already been mined, then minted 10 will result in a valid amount of 2(100-98), not 10.
-	From          string   `json:"from"`
-	To            string   `json:"to"`
-	SatOffset     string   `json:"sat_offset"` // sat's offset range, for instance: if input is the second position and sat's offset range is [10, 15], then the inscription's offset in the transaction is [input[1].offset + 10, input[1].offset + 15]. This is then compared with the output's offset range to select the corresponding output.
-	BlockHeight   int64    `json:"block_height"`
-	BlockTime     int64    `json:"block_time"`
-	Position      int      `json:"pos"`
-	InputIndex    int      `json:"input_idx"`
-	OutputIndex   int      `json:"output_idx"`
-	Status        TxStatus `json:"status"` // 0:not validated 1:valid 2:invalid
-	Reason        string   `json:"reason"`
-	Meta          string   `json:"meta"`    // ordinal meta, e.g: text/plain
-	Content       string   `json:"content"` // ordinal raw content
+	Id            int64    `db:"id,pk,autoincr" json:"id"`
+	TxId          string   `db:"txid" json:"txid"`
+	InscriptionId string   `db:"inscription_id" json:"inscription_id"`
+	Operation     string   `db:"op" json:"op"`
+	Tick          string   `db:"tick" json:"tick"`
+	Amount        string   `db:"amt" json:"amt"`
+	ValidAmount   string   `db:"valid_amt" json:"valid_amt"` // valid amount, If the total supply is 100 and 98 has already been mined, then minted 10 will result in a valid amount of 2(100-98), not 10.
+	From          string   `db:"from" json:"from"`
+	To            string   `db:"to" json:"to"`
+	SatOffset     string   `db:"sat_offset" json:"sat_offset"` // sat's offset range, for instance: if input is the second position and sat's offset range is [10, 15], then the inscription's offset in the transaction is [input[1].offset + 10, input[1].offset + 15]. This is then compared with the output's offset range to select the corresponding output.
+	BlockHeight   int64    `db:"block_height" json:"block_height"`
+	BlockTime     int64    `db:"block_time" json:"block_time"`
+	Position      int      `db:"pos" json:"pos"`
+	InputIndex    int      `db:"input_idx" json:"input_idx"`
+	OutputIndex   int      `db:"output_idx" json:"output_idx"`
+	Status        TxStatus `db:"status" json:"status"` // 0:not validated 1:valid 2:invalid
+	Reason        string   `db:"reason" json:"reason"`
+	Meta          string   `db:"meta" json:"meta"`       // ordinal meta, e.g: text/plain
+	Content       string   `db:"content" json:"content"` // ordinal raw content
 }
@@ -0,0 +1,11 @@
+package models
+
+// TxShadow is the validation result of a tx computed by a revalidation, it's swapped into ord_tx when the revalidation finishes.
+type TxShadow struct {
+	meta        string   `table:"ord_tx_shadow"`
+	Id          int64    `db:"id,pk,autoincr" json:"id"`
+	TxRowId     int64    `db:"tx_row_id" json:"tx_row_id"` // id of the tx in ord_tx
+	Status      TxStatus `db:"status" json:"status"`
+	Reason      string   `db:"reason" json:"reason"`
+	ValidAmount string   `db:"valid_amt" json:"valid_amt"`
+}
@@ -0,0 +1,20 @@
+package res
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+)
+
+// Context is the root context of a command, it's cancelled on SIGINT or SIGTERM so that the queries and RPC calls in progress are
+// cancelled and the command exits with their errors. The default handling of the signals is restored then, another one kills it at once.
+func Context() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		log.Printf("received signal, cancelling the queries and rpc calls")
+	}()
+	return ctx
+}
@@ -0,0 +1,127 @@
+package res
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"libord/pkg/orm"
+	"log"
+	"strings"
+	"time"
+)
+
+// lockCheckInterval is how often the holder checks that it still holds the lock.
+const lockCheckInterval = 30 * time.Second
+
+// Lock is a MySQL advisory lock taken by GET_LOCK, or a postgres session level advisory lock. It's bound to the connection holding it, so it's released as soon as
+// the process exits or loses the connection, and a standby process waiting for it takes over.
+type Lock struct {
+	Name    string
+	conn    *sql.Conn
+	key     any // the name for MySQL, or the bigint key of the postgres advisory lock
+	queries lockQueries
+	stop    chan struct{}
+}
+
+// lockQueries: the queries of the lock in the dialect, the session level advisory lock of postgres is taken for GET_LOCK.
+// All of them take the key of the lock.
+type lockQueries struct {
+	get     string // returns 1 if the lock is taken
+	check   string // returns 1 if the lock is still held by the connection
+	holder  string
+	release string
+}
+
+var (
+	mysqlLockQueries = lockQueries{
+		get:     "select get_lock(?,?)",
+		check:   "select is_used_lock(?)=connection_id()",
+		holder:  "select is_used_lock(?)",
+		release: "select release_lock(?)",
+	}
+	postgresLockQueries = lockQueries{
+		get:     "select pg_try_advisory_lock($1)::int",
+		check:   "select count(*) from pg_locks where locktype='advisory' and granted and pid=pg_backend_pid() and (classid::bigint<<32|objid::bigint)=$1",
+		holder:  "select pid from pg_locks where locktype='advisory' and granted and (classid::bigint<<32|objid::bigint)=$1",
+		release: "select pg_advisory_unlock($1)",
+	}
+)
+
+// LockName: the lock of the role, e.g: indexer or validator, on the chain.
+func LockName(chain, role string) string {
+	return fmt.Sprintf("ord.%s.%s", strings.ToLower(chain), role)
+}
+
+// GetLock takes the lock of the role on the chain, or exits if another process holds it for more than wait seconds, or if ctx is
+// cancelled while waiting. A negative wait waits forever, e.g: for a standby process. The process exits too if the lock is lost later.
+func GetLock(ctx context.Context, db *sql.DB, chain, role string, wait int) *Lock {
+	name := LockName(chain, role)
+	if orm.DialectOf(db) == orm.SQLite {
+		// The database file is local, it's up to the operator not to run the same role twice on it.
+		log.Printf("[WARN] sqlite has no advisory lock, lock:%s is not taken", name)
+		return &Lock{Name: name}
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Fatalf("get connection of lock:%s error:%+v", name, err)
+	}
+	log.Printf("taking lock:%s", name)
+	queries, key := mysqlLockQueries, any(name)
+	var ret sql.NullInt64
+	if orm.DialectOf(db) == orm.Postgres {
+		// The key is kept positive and below 2^62, so that it's the same as the classid and objid of pg_locks.
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		queries, key = postgresLockQueries, int64(h.Sum64()>>2)
+		// There is no timeout of the advisory lock, try it every second instead.
+		for start := time.Now(); ; time.Sleep(time.Second) {
+			if err = conn.QueryRowContext(ctx, queries.get, key).Scan(&ret); err != nil || ret.Int64 == 1 || (wait >= 0 && time.Since(start) >= time.Duration(wait)*time.Second) {
+				break
+			}
+		}
+	} else {
+		err = conn.QueryRowContext(ctx, queries.get, key, wait).Scan(&ret)
+	}
+	if err != nil {
+		log.Fatalf("get lock:%s error:%+v", name, err)
+	} else if ret.Int64 != 1 {
+		var holder sql.NullInt64
+		_ = conn.QueryRowContext(context.Background(), queries.holder, key).Scan(&holder)
+		log.Fatalf("lock:%s is held by connection:%d, another %s of %s is running", name, holder.Int64, role, chain)
+	}
+	log.Printf("took lock:%s", name)
+
+	lock := &Lock{Name: name, conn: conn, key: key, queries: queries, stop: make(chan struct{})}
+	go lock.watch()
+	return lock
+}
+
+// watch: exit if the lock is lost, e.g: the database restarted, as another process may have taken it over.
+func (l *Lock) watch() {
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(lockCheckInterval):
+		}
+		var held sql.NullInt64
+		if err := l.conn.QueryRowContext(context.Background(), l.queries.check, l.key).Scan(&held); err != nil {
+			log.Fatalf("check lock:%s error:%+v", l.Name, err)
+		} else if held.Int64 != 1 {
+			log.Fatalf("lock:%s lost", l.Name)
+		}
+	}
+}
+
+// Release releases the lock and its connection.
+func (l *Lock) Release() {
+	if l.conn == nil {
+		return
+	}
+	close(l.stop)
+	if _, err := l.conn.ExecContext(context.Background(), l.queries.release, l.key); err != nil {
+		log.Printf("[WARN] release lock:%s error:%+v", l.Name, err)
+	}
+	_ = l.conn.Close()
+}
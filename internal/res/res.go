@@ -4,14 +4,29 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-func GetDb(host, name, user, password string) *sql.DB {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&maxAllowedPacket=1073741824&multiStatements=true&parseTime=true&loc=Local", user, password, host, name)
-	_db, err := sql.Open("mysql", dsn)
+// GetDb opens the database by the driver: mysql, which is the default, postgres, or sqlite whose name is the path of the database file.
+func GetDb(driver, host, name, user, password string) *sql.DB {
+	var dsn string
+	switch driver {
+	case "", "mysql":
+		driver = "mysql"
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&maxAllowedPacket=1073741824&multiStatements=true&parseTime=true&loc=Local", user, password, host, name)
+	case "postgres":
+		dsn = (&url.URL{Scheme: "postgres", User: url.UserPassword(user, password), Host: host, Path: name, RawQuery: "sslmode=disable"}).String()
+	case "sqlite":
+		dsn = name + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"
+	default:
+		log.Fatalf("db driver:%s not supported", driver)
+	}
+	_db, err := sql.Open(driver, dsn)
 	if err != nil {
 		log.Fatalf("open db:%s error:%+v", name, err)
 	}
@@ -20,6 +35,10 @@ func GetDb(host, name, user, password string) *sql.DB {
 	}
 	_db.SetMaxIdleConns(500)
 	_db.SetMaxOpenConns(500)
+	if driver == "sqlite" {
+		// There is a single writer of the file anyway, the writes wait for each other instead of failing as busy.
+		_db.SetMaxOpenConns(1)
+	}
 	_db.SetConnMaxLifetime(30 * time.Minute)
 	return _db
 }
@@ -0,0 +1,14 @@
+package res
+
+import (
+	"database/sql"
+	"libord/internal/migrate"
+	"log"
+)
+
+// CheckSchema exits if the schema of the chain isn't at the version the binary is built for.
+func CheckSchema(db *sql.DB, chain string) {
+	if err := (&migrate.Migrator{Chain: chain, Db: db}).Check(); err != nil {
+		log.Fatalf("check schema error:%+v", err)
+	}
+}
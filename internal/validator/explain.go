@@ -0,0 +1,144 @@
+package validator
+
+import (
+	"fmt"
+	"libord/config"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Explanation is how an op of a tx is validated.
+type Explanation struct {
+	Tx        *models.Tx
+	Patch     *models.Patch // the status is forced by the patch if it's not nil
+	Validated bool          // false if the block of the tx has not been validated yet, the latest balances are used then
+	Tick      *models.Tick  // the tick just before the tx
+	Balances  []*models.Address
+	Rules     []*engine.Rule
+}
+
+// explainState is the state just before a tx, which is only read by engine.Explain.
+type explainState struct {
+	*dbState
+	tick      *models.Tick
+	addresses map[string]*models.Address
+}
+
+func (s *explainState) Tick(name string) (*models.Tick, error) {
+	if s.tick != nil && strings.EqualFold(s.tick.Name, name) {
+		return s.tick, nil
+	}
+	return nil, nil
+}
+
+func (s *explainState) Address(tick, address string) (*models.Address, error) {
+	return s.addresses[addressKey(tick, address)], nil
+}
+
+func (s *explainState) Commit(result *engine.Result) error {
+	return errors.Errorf("explain state is read only")
+}
+
+// Explain traces the validation of every op of the tx: the balances just before it and the rules it passed or failed.
+func (s *Validator) Explain(txid string) (ret []*Explanation, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var items []*models.Tx
+	if items, err = orm.Find[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", txid).OrderBy("InputIndex").OrderBy("Id")); err != nil {
+		return
+	} else if len(items) == 0 {
+		err = errors.Errorf("tx:%s not found", txid)
+		return
+	}
+	validatorBlock := s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block")
+	for _, tx := range items {
+		explanation := &Explanation{Tx: tx, Validated: tx.BlockHeight <= validatorBlock}
+		if explanation.Patch, err = orm.First[*models.Patch](_orm, _m.Bind(&models.Patch{}).Where("TxId", tx.TxId).Where("Operation", tx.Operation).Where("InputIndex", tx.InputIndex)); err != nil {
+			return
+		}
+
+		state := &explainState{dbState: &dbState{Chain: s.Chain, Db: s.Db, Ctx: s.Ctx}, addresses: make(map[string]*models.Address)}
+		if tick, _err := orm.First[*models.Tick](_orm, _m.Bind(&models.Tick{}).Where("Name", tx.Tick)); _err != nil {
+			err = _err
+			return
+		} else if tick != nil {
+			state.tick = tick
+			if explanation.Validated {
+				if state.tick.MintedAmount, err = s.mintedBefore(state.tick, tx); err != nil {
+					return
+				}
+			}
+			explanation.Tick = state.tick
+			for _, address := range []string{tx.From, tx.To} {
+				if address == "" || state.addresses[addressKey(state.tick.Name, address)] != nil {
+					continue
+				}
+				var balance *models.Address
+				if balance, err = s.balanceBefore(state.tick.Name, address, tx, explanation.Validated); err != nil {
+					return
+				}
+				state.addresses[addressKey(state.tick.Name, address)] = balance
+				explanation.Balances = append(explanation.Balances, balance)
+			}
+		}
+
+		e := &engine.Engine{Protocol: config.Instance().OrdProtocolName[strings.ToLower(s.Chain)], State: state}
+		if explanation.Rules, err = e.Explain(tx); err != nil {
+			return
+		}
+		ret = append(ret, explanation)
+	}
+	return
+}
+
+// txBefore: the condition of the balance events before the tx in the order of validation.
+func txBefore(tx *models.Tx) (string, []any) {
+	return "(block<? or (block=? and (pos<? or (pos=? and input_idx<?))))", []any{tx.BlockHeight, tx.BlockHeight, tx.Position, tx.Position, tx.InputIndex}
+}
+
+// mintedBefore: the minted amount of the tick just before the tx, i.e., the amounts minted since the tx are subtracted.
+func (s *Validator) mintedBefore(tick *models.Tick, tx *models.Tx) (minted string, err error) {
+	_orm := s.newOrm()
+	condition, args := txBefore(tx)
+	var items []any
+	if items, err = _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select available_delta from %sord_balance_event where tick=? and op='mint' and not %s", strings.ToLower(s.Chain)+"_", condition), append([]any{tick.Name}, args...)...)); err != nil {
+		return
+	}
+	amount := conv.Decimal(tick.MintedAmount)
+	for _, item := range items {
+		amount = amount.Sub(conv.Decimal(item.(map[string]any)["available_delta"]))
+	}
+	minted = amount.String()
+	return
+}
+
+// balanceBefore: the balance of the address just before the tx, which is the latest balance if the tx is not validated.
+func (s *Validator) balanceBefore(tick, address string, tx *models.Tx, validated bool) (ret *models.Address, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	if !validated {
+		ret = &models.Address{Tick: tick, Address: address}
+		if item, _err := orm.First[*models.Address](_orm, _m.Bind(&models.Address{}).Where("Tick", tick).Where("Address", address)); _err != nil {
+			err = _err
+		} else if item != nil {
+			ret = item
+		}
+		return
+	}
+	condition, args := txBefore(tx)
+	var items []any
+	if items, err = _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select available,transferable,block from %sord_balance_event where tick=? and address=? and %s order by block desc,pos desc,input_idx desc,id desc limit 1", strings.ToLower(s.Chain)+"_", condition), append([]any{tick, address}, args...)...)); err != nil {
+		return
+	} else if len(items) > 0 {
+		m := items[0].(map[string]any)
+		ret = &models.Address{Tick: tick, Address: address, Available: conv.String(m["available"]), Transferable: conv.String(m["transferable"]), BlockAtUpdate: conv.Int64(m["block"])}
+		return
+	}
+	// No event before the tx, the balance is in the snapshot if any.
+	return s.BalanceAt(tx.BlockHeight-1, tick, address)
+}
@@ -0,0 +1,205 @@
+package validator
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"libord/pkg/slice"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BlockHash returns the state commitment hash saved for the block, the latest validated block is used if block <= 0.
+func (s *Validator) BlockHash(block int64) (hash string, err error) {
+	if block <= 0 {
+		block = s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block")
+	}
+	return s.getBlockHash(s.newOrm(), block)
+}
+
+// blockHash: sha256 over the previous block's hash and the sorted changes of the block, so that the hash of a block
+// commits to the whole brc-20 state up to it. Amounts are normalized to make "" and "0" hash the same.
+func blockHash(block int64, prevHash string, result *engine.Result) string {
+	var lines []string
+	for _, tick := range result.Ticks {
+		lines = append(lines, fmt.Sprintf("tick:%s,%s,%s", strings.ToLower(tick.Name), conv.Decimal(tick.MintedAmount).String(), tick.FinishMintTx))
+	}
+	for _, address := range result.Addresses {
+		lines = append(lines, fmt.Sprintf("address:%s,%s,%s,%s", strings.ToLower(address.Tick), address.Address, conv.Decimal(address.Available).String(), conv.Decimal(address.Transferable).String()))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	h.Write([]byte(fmt.Sprintf("%s\n%d\n", prevHash, block)))
+	for _, line := range lines {
+		h.Write([]byte(line + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Validator) saveBlockHash(_orm *orm.Orm, block, genesisBlock int64, result *engine.Result) (err error) {
+	var prevHash string
+	if prevHash, err = s.getBlockHash(_orm, block-1); err != nil {
+		return
+	}
+	if prevHash == "" && block-1 > genesisBlock {
+		log.Printf("[WARN] no hash found at block:%d, block:%d starts a new hash chain", block-1, block)
+	}
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	obj := &models.BlockHash{Block: block, Hash: blockHash(block, prevHash, result), PrevHash: prevHash}
+	// A block may be validated again after a crash, replace the old hash.
+	_, _, err = _orm.Save(_m.Bind(obj).BatchData(obj).Upsert("Block"))
+	return
+}
+
+func (s *Validator) getBlockHash(_orm *orm.Orm, block int64) (hash string, err error) {
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var value any
+	if value, err = _orm.One(_m.Bind(&models.BlockHash{}).Where("Block", block), "hash"); err != nil {
+		return
+	}
+	hash = conv.String(value)
+	return
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so the hashes can be recomputed in the transaction that changes the balances.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// rehashBlocks: recompute the hashes of the blocks in (startBlock, endBlock] from the balance events and the ticks, and replace
+// the saved ones. The ticks must be in their state at endBlock, their minted amounts at a block are unwound by the mint events
+// after it. It hashes the same changes as Run does: the ticks minted and the last balance of the addresses journaled in a block.
+func (s *Validator) rehashBlocks(q queryer, startBlock, endBlock int64) (err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	rebind := orm.DialectOf(s.Db).Rebind
+	ticks := make(map[string]*models.Tick)
+	var rows *sql.Rows
+	if rows, err = q.QueryContext(s.context(), fmt.Sprintf("select name,coalesce(minted,''),coalesce(finish_mint_tx,'') from %sord_tick", prefix)); err != nil {
+		return
+	}
+	for rows.Next() {
+		tick := &models.Tick{}
+		if err = rows.Scan(&tick.Name, &tick.MintedAmount, &tick.FinishMintTx); err != nil {
+			rows.Close()
+			return
+		}
+		ticks[strings.ToLower(tick.Name)] = tick
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+
+	var events []*models.BalanceEvent
+	if rows, err = q.QueryContext(s.context(), rebind(fmt.Sprintf("select block,txid,op,tick,address,available_delta,available,transferable from %sord_balance_event where block>? and block<=? order by block,id", prefix)), startBlock, endBlock); err != nil {
+		return
+	}
+	for rows.Next() {
+		event := &models.BalanceEvent{}
+		if err = rows.Scan(&event.Block, &event.TxId, &event.Operation, &event.Tick, &event.Address, &event.AvailableDelta, &event.Available, &event.Transferable); err != nil {
+			rows.Close()
+			return
+		}
+		events = append(events, event)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+
+	// Unwind the ticks to startBlock, a tick finished in the range isn't finished before its last mint.
+	finishMintTxs := make(map[string]string)
+	for _, event := range events {
+		if !strings.EqualFold(event.Operation, "mint") {
+			continue
+		}
+		tick := ticks[strings.ToLower(event.Tick)]
+		if tick == nil {
+			err = errors.Errorf("tick:%s of the balance event:%s not found", event.Tick, event.TxId)
+			return
+		}
+		tick.MintedAmount = conv.Decimal(tick.MintedAmount).Sub(conv.Decimal(event.AvailableDelta)).String()
+		if tick.FinishMintTx != "" && tick.FinishMintTx == event.TxId {
+			finishMintTxs[strings.ToLower(tick.Name)], tick.FinishMintTx = tick.FinishMintTx, ""
+		}
+	}
+
+	var prevHash string
+	if prevHash, err = s.queryBlockHash(q, startBlock); err != nil {
+		return
+	}
+	var hashes []*models.BlockHash
+	for block, i := startBlock+1, 0; block <= endBlock; block++ {
+		result := &engine.Result{}
+		addresses := make(map[string]*models.Address)
+		minted := make(map[string]*models.Tick)
+		for ; i < len(events) && events[i].Block == block; i++ {
+			event := events[i]
+			key := strings.ToLower(event.Tick) + "," + event.Address
+			if addresses[key] == nil {
+				addresses[key] = &models.Address{Tick: event.Tick, Address: event.Address}
+				result.Addresses = append(result.Addresses, addresses[key])
+			}
+			addresses[key].Available, addresses[key].Transferable = event.Available, event.Transferable
+			if !strings.EqualFold(event.Operation, "mint") {
+				continue
+			}
+			tick := ticks[strings.ToLower(event.Tick)]
+			tick.MintedAmount = conv.Decimal(tick.MintedAmount).Add(conv.Decimal(event.AvailableDelta)).String()
+			if finishMintTxs[strings.ToLower(tick.Name)] == event.TxId {
+				tick.FinishMintTx = event.TxId
+			}
+			if minted[strings.ToLower(tick.Name)] == nil {
+				minted[strings.ToLower(tick.Name)] = tick
+				result.Ticks = append(result.Ticks, tick)
+			}
+		}
+		hashes = append(hashes, &models.BlockHash{Block: block, Hash: blockHash(block, prevHash, result), PrevHash: prevHash})
+		prevHash = hashes[len(hashes)-1].Hash
+	}
+	return s.replaceBlockHashes(q, startBlock, hashes)
+}
+
+// queryBlockHash: the saved hash of the block through q, empty if not found.
+func (s *Validator) queryBlockHash(q queryer, block int64) (hash string, err error) {
+	var rows *sql.Rows
+	if rows, err = q.QueryContext(s.context(), orm.DialectOf(s.Db).Rebind(fmt.Sprintf("select hash from %sord_block_hash where block=?", strings.ToLower(s.Chain)+"_")), block); err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&hash)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// replaceBlockHashes: replace the saved hashes after startBlock with the hashes.
+func (s *Validator) replaceBlockHashes(q queryer, startBlock int64, hashes []*models.BlockHash) (err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	rebind := orm.DialectOf(s.Db).Rebind
+	if _, err = q.ExecContext(s.context(), rebind(fmt.Sprintf("delete from %sord_block_hash where block>?", prefix)), startBlock); err != nil {
+		return
+	}
+	for parti := range slice.Partition(len(hashes), 500) {
+		var args []any
+		for _, hash := range hashes[parti.Low:parti.High] {
+			args = append(args, hash.Block, hash.Hash, hash.PrevHash)
+		}
+		values := strings.TrimSuffix(strings.Repeat("(?,?,?),", parti.High-parti.Low), ",")
+		if _, err = q.ExecContext(s.context(), rebind(fmt.Sprintf("insert into %sord_block_hash(block,hash,prev_hash) values %s", prefix, values)), args...); err != nil {
+			return
+		}
+	}
+	return
+}
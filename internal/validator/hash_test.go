@@ -0,0 +1,101 @@
+package validator
+
+import (
+	"libord/config"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"libord/pkg/orm"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BlockHash(t *testing.T) {
+	result := &engine.Result{
+		Ticks: []*models.Tick{{Name: "ORDI", MintedAmount: "2000"}},
+		Addresses: []*models.Address{
+			{Tick: "ordi", Address: "bc1qa", Available: "1000"},
+			{Tick: "ordi", Address: "bc1qb", Available: "1000", Transferable: "0"},
+		},
+	}
+	hash := blockHash(800000, "", result)
+	assert.Len(t, hash, 64)
+
+	// The order of changes and the notation of amounts don't change the hash.
+	reordered := &engine.Result{
+		Ticks: []*models.Tick{{Name: "ordi", MintedAmount: "2000.0"}},
+		Addresses: []*models.Address{
+			{Tick: "ORDI", Address: "bc1qb", Available: "1000", Transferable: ""},
+			{Tick: "ORDI", Address: "bc1qa", Available: "1000", Transferable: "0"},
+		},
+	}
+	assert.Equal(t, hash, blockHash(800000, "", reordered))
+
+	// The hash is chained to the previous block and bound to the height.
+	assert.NotEqual(t, hash, blockHash(800000, hash, result))
+	assert.NotEqual(t, hash, blockHash(800001, "", result))
+
+	result.Addresses[1].Available = "999"
+	assert.NotEqual(t, hash, blockHash(800000, "", result))
+}
+
+// blockHashes: the saved hashes by block.
+func blockHashes(t *testing.T, s *Validator) map[int64]*models.BlockHash {
+	items, err := orm.Find[*models.BlockHash](s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.BlockHash{}))
+	assert.Nil(t, err)
+	ret := make(map[int64]*models.BlockHash)
+	for _, item := range items {
+		item.Id = 0
+		ret[item.Block] = item
+	}
+	return ret
+}
+
+func Test_RehashBlocks(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected := blockHashes(t, s)
+	assert.Len(t, expected, 4)
+	assert.Equal(t, expected[102].Hash, expected[103].PrevHash)
+
+	// The ticks are finished at block 102, the hashes before it are unwound to the unfinished ticks.
+	for _, startBlock := range []int64{99, 101, 102} {
+		_, err := s.Db.Exec("update btc_ord_block_hash set hash='',prev_hash='' where block>?", startBlock)
+		assert.Nil(t, err)
+		assert.Nil(t, s.rehashBlocks(s.Db, startBlock, 103))
+		assert.Equal(t, expected, blockHashes(t, s))
+	}
+}
+
+func Test_RunInterrupted(t *testing.T) {
+	interval := config.Instance().SnapshotInterval
+	config.Instance().SnapshotInterval = map[string]int64{"btc": 51}
+	defer func() {
+		config.Instance().SnapshotInterval = interval
+	}()
+	expected := newTestValidator(t)
+	assert.Nil(t, expected.Run())
+
+	// The snapshot of block 102 fails after its changes are written, none of them is kept.
+	s := newTestValidator(t)
+	_, err := s.Db.Exec("alter table btc_ord_balance_snapshot rename to btc_ord_balance_snapshot_moved")
+	assert.Nil(t, err)
+	_, err = s.Db.Exec("create table btc_ord_balance_snapshot (id integer primary key autoincrement)")
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Run())
+	assert.Equal(t, int64(101), s.getDictValue("btc.ord.validator.block"))
+	assert.Equal(t, map[string]string{"bc1qa": "400,0", "bc1qb": "400,0"}, balances(t, s, "ordi"))
+	assert.Len(t, blockHashes(t, s), 2)
+	var count int
+	assert.Nil(t, s.Db.QueryRow("select count(*) from btc_ord_balance_event where block>101").Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// The block is validated again to the same hash chain.
+	_, err = s.Db.Exec("drop table btc_ord_balance_snapshot")
+	assert.Nil(t, err)
+	_, err = s.Db.Exec("alter table btc_ord_balance_snapshot_moved rename to btc_ord_balance_snapshot")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Run())
+	assert.Equal(t, balances(t, expected, "ordi"), balances(t, s, "ordi"))
+	assert.Equal(t, blockHashes(t, expected), blockHashes(t, s))
+}
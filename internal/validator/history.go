@@ -0,0 +1,257 @@
+package validator
+
+import (
+	"fmt"
+	"libord/config"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BalanceAt returns the balance of the address at the block, which is the latest balance event not after the block,
+// or the latest snapshot of the tick if the address has no event after it. An error is returned if the balance events
+// and snapshots of the tick don't cover the block, e.g: it was validated before the balance events were kept.
+func (s *Validator) BalanceAt(block int64, tick, address string) (ret *models.Address, err error) {
+	if err = s.checkHistoryBlock(block); err != nil {
+		return
+	}
+	if err = s.checkJournalCovers(block, tick); err != nil {
+		return
+	}
+	return s.balanceAt(block, tick, address)
+}
+
+// balanceAt: the balance of the address at the block, the block must be covered by the journal of the tick.
+func (s *Validator) balanceAt(block int64, tick, address string) (ret *models.Address, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	ret = &models.Address{Tick: tick, Address: address}
+
+	var snapshotBlock int64
+	if snapshotBlock, err = s.latestSnapshotBlock(block, tick); err != nil {
+		return
+	}
+	if event, _err := orm.First[*models.BalanceEvent](_orm, _m.Bind(&models.BalanceEvent{}).Where("Tick", tick).Where("Address", address).WhereGT("Block", snapshotBlock).WhereLTE("Block", block).OrderByDesc("Block").OrderByDesc("Position").OrderByDesc("InputIndex").OrderByDesc("Id").Limit(1)); _err != nil {
+		err = _err
+		return
+	} else if event != nil {
+		ret.Available, ret.Transferable, ret.BlockAtUpdate = event.Available, event.Transferable, event.Block
+		return
+	}
+	if snapshotBlock > 0 { // zero balances are not in the snapshot
+		if snapshot, _err := orm.First[*models.BalanceSnapshot](_orm, _m.Bind(&models.BalanceSnapshot{}).Where("Tick", tick).Where("Address", address).Where("Block", snapshotBlock)); _err != nil {
+			err = _err
+			return
+		} else if snapshot != nil {
+			ret.Available, ret.Transferable, ret.BlockAtUpdate = snapshot.Available, snapshot.Transferable, snapshot.Block
+		}
+	}
+	return
+}
+
+// HoldersAt returns the balances of all addresses holding the tick at the block, ordered by address.
+// The balances are rebuilt from the latest snapshot not after the block by replaying the balance events after it,
+// an error is returned if they don't cover the block as BalanceAt does.
+func (s *Validator) HoldersAt(block int64, tick string) (ret []*models.Address, err error) {
+	if err = s.checkHistoryBlock(block); err != nil {
+		return
+	}
+	if err = s.checkJournalCovers(block, tick); err != nil {
+		return
+	}
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	holders := make(map[string]*models.Address)
+
+	var snapshotBlock int64
+	if snapshotBlock, err = s.latestSnapshotBlock(block, tick); err != nil {
+		return
+	}
+	if snapshotBlock > 0 {
+		log.Printf("loading snapshot of tick:%s at block:%d", tick, snapshotBlock)
+		if err = _orm.Each(_m.Bind(&models.BalanceSnapshot{}).Where("Tick", tick).Where("Block", snapshotBlock), func(item any) error {
+			snapshot := item.(*models.BalanceSnapshot)
+			holders[snapshot.Address] = &models.Address{Tick: snapshot.Tick, Address: snapshot.Address, Available: snapshot.Available, Transferable: snapshot.Transferable, BlockAtUpdate: snapshot.Block}
+			return nil
+		}); err != nil {
+			return
+		}
+	}
+
+	// The events of a tick are appended in the order of validation, so the id order is the order of the changes.
+	log.Printf("replaying balance events of tick:%s from block:%d to %d", tick, snapshotBlock+1, block)
+	if err = _orm.Each(_m.Bind(&models.BalanceEvent{}).Where("Tick", tick).WhereGT("Block", snapshotBlock).WhereLTE("Block", block).OrderBy("Id"), func(item any) error {
+		event := item.(*models.BalanceEvent)
+		holders[event.Address] = &models.Address{Tick: event.Tick, Address: event.Address, Available: event.Available, Transferable: event.Transferable, BlockAtUpdate: event.Block}
+		return nil
+	}); err != nil {
+		return
+	}
+
+	for _, holder := range holders {
+		if conv.Decimal(holder.Available).IsZero() && conv.Decimal(holder.Transferable).IsZero() {
+			continue
+		}
+		ret = append(ret, holder)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Address < ret[j].Address
+	})
+	return
+}
+
+// latestSnapshotBlock: the block of the latest snapshot of the tick not after the block, 0 if there is none.
+func (s *Validator) latestSnapshotBlock(block int64, tick string) (snapshotBlock int64, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var blocks []int64
+	if blocks, err = orm.Pluck[int64](_orm, _m.Bind(&models.BalanceSnapshot{}).Where("Tick", tick).WhereLTE("Block", block).OrderByDesc("Block").Limit(1), "Block"); err != nil || len(blocks) == 0 {
+		return
+	}
+	snapshotBlock = blocks[0]
+	return
+}
+
+// journalStart: the block since which the balance events are kept, i.e., the earliest snapshot or the block before the
+// earliest balance event, ok is false if neither is kept yet.
+func (s *Validator) journalStart() (block int64, ok bool, err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	_orm := s.newOrm()
+	for _, table := range []string{"ord_balance_snapshot", "ord_balance_event"} {
+		var value any
+		if value, err = _orm.One((&orm.Model{}).Extra(fmt.Sprintf("select min(block) as b from %s%s", prefix, table)), "b"); err != nil {
+			return
+		} else if conv.String(value) == "" {
+			continue
+		}
+		start := conv.Int64(value)
+		if table == "ord_balance_event" {
+			start--
+		}
+		if !ok || start < block {
+			block, ok = start, true
+		}
+	}
+	return
+}
+
+// journalCovers: whether the balances of the tick at the block can be told from the balance events and snapshots. The journal
+// of a tick is complete if no valid tx of the tick was validated before the journal started, or else only the blocks after
+// a snapshot taken since then can be told, e.g: the blocks validated before the balance events were kept.
+func (s *Validator) journalCovers(block int64, tick string) (ok bool, err error) {
+	var start int64
+	if start, ok, err = s.journalStart(); err != nil {
+		return
+	} else if !ok {
+		// Nothing is kept yet, all validated blocks are before the journal.
+		start = s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block")
+	}
+	_orm := s.newOrm()
+	var value any
+	if value, err = _orm.One((&orm.Model{}).Extra(fmt.Sprintf("select count(*) as c from %sord_tx where lower(tick)=? and status=? and op<>'deploy' and block_height<=?", strings.ToLower(s.Chain)+"_"), strings.ToLower(tick), models.TxStatusValid, start), "c"); err != nil {
+		return
+	} else if conv.Int64(value) == 0 {
+		ok = true
+		return
+	}
+	var snapshotBlock int64
+	if snapshotBlock, err = s.latestSnapshotBlock(block, tick); err != nil {
+		return
+	}
+	ok = snapshotBlock > 0 && snapshotBlock >= start
+	return
+}
+
+// checkJournalCovers: an error if the journal of the tick doesn't cover the block.
+func (s *Validator) checkJournalCovers(block int64, tick string) error {
+	if ok, err := s.journalCovers(block, tick); err != nil {
+		return err
+	} else if !ok {
+		return errors.Errorf("the balance events of tick:%s don't cover block:%d, it was validated before they were kept", tick, block)
+	}
+	return nil
+}
+
+// startJournal: take a snapshot of the balances at the block if blocks were validated before the balance events were kept,
+// so that the balances after it can be told.
+func (s *Validator) startJournal(block, genesisBlock int64) (err error) {
+	if block <= genesisBlock {
+		return
+	}
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	if event, _err := orm.First[*models.BalanceEvent](s.newOrm(), _m.Bind(&models.BalanceEvent{}).Limit(1)); _err != nil || event != nil {
+		err = _err
+		return
+	}
+	if snapshot, _err := orm.First[*models.BalanceSnapshot](s.newOrm(), (&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(&models.BalanceSnapshot{}).Limit(1)); _err != nil || snapshot != nil {
+		err = _err
+		return
+	}
+	log.Printf("no balance events kept yet, starting the journal at block:%d", block)
+	tx, err := s.Db.BeginTx(s.context(), nil)
+	if err != nil {
+		return
+	}
+	_orm := s.newOrm()
+	_orm.Tx = tx
+	if err = s.snapshot(_orm, block); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// checkHistoryBlock: the history is only known up to the latest validated block.
+func (s *Validator) checkHistoryBlock(block int64) error {
+	if validatorBlock := s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block"); block > validatorBlock {
+		return errors.Errorf("block:%d has not been validated yet, the latest validated block is %d", block, validatorBlock)
+	}
+	return nil
+}
+
+// snapshotIfNeeded: take a balance snapshot after the block every snapshot interval blocks.
+func (s *Validator) snapshotIfNeeded(_orm *orm.Orm, block int64) error {
+	if interval := config.Instance().SnapshotInterval[strings.ToLower(s.Chain)]; interval > 0 && block%interval == 0 {
+		return s.snapshot(_orm, block)
+	}
+	return nil
+}
+
+// snapshot: copy all balances in ord_address into the snapshot of the block.
+func (s *Validator) snapshot(_orm *orm.Orm, block int64) (err error) {
+	log.Printf("taking balance snapshot at block:%d", block)
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	// The snapshot may be taken again after a crash.
+	if _, err = _orm.Delete(_m.Bind(&models.BalanceSnapshot{}).Where("Block", block)); err != nil {
+		return
+	}
+	var snapshots []any
+	save := func() (err error) {
+		if len(snapshots) > 0 {
+			_, _, err = _orm.Save((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(&models.BalanceSnapshot{}).BatchData(snapshots...))
+			snapshots = nil
+		}
+		return
+	}
+	if err = _orm.EachPage(_m.Bind(&models.Address{}), 2000, func(item any) error {
+		address := item.(*models.Address)
+		if conv.Decimal(address.Available).IsZero() && conv.Decimal(address.Transferable).IsZero() {
+			return nil
+		}
+		snapshots = append(snapshots, &models.BalanceSnapshot{Block: block, Address: address.Address, Tick: address.Tick, Available: address.Available, Transferable: address.Transferable})
+		if len(snapshots) < 2000 {
+			return nil
+		}
+		return save()
+	}); err != nil {
+		return
+	}
+	err = save()
+	return
+}
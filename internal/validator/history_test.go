@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"libord/config"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// balanceOf: the available and transferable balances of the address, "" is taken as 0.
+func balanceOf(address *models.Address) string {
+	return conv.Decimal(address.Available).String() + "," + conv.Decimal(address.Transferable).String()
+}
+
+func Test_History(t *testing.T) {
+	interval := config.Instance().SnapshotInterval
+	config.Instance().SnapshotInterval = map[string]int64{"btc": 2}
+	defer func() {
+		config.Instance().SnapshotInterval = interval
+	}()
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	balanceAt := func(block int64, address string) string {
+		balance, err := s.BalanceAt(block, "ordi", address)
+		assert.Nil(t, err)
+		return balanceOf(balance)
+	}
+	holdersAt := func(block int64) (ret []string) {
+		holders, err := s.HoldersAt(block, "ordi")
+		assert.Nil(t, err)
+		for _, holder := range holders {
+			ret = append(ret, holder.Address+":"+balanceOf(holder))
+		}
+		return
+	}
+
+	// Before the first event of the address.
+	assert.Equal(t, "0,0", balanceAt(100, "bc1qa"))
+	assert.Equal(t, "0,0", balanceAt(102, "bc1qc"))
+	assert.Nil(t, holdersAt(100))
+	// Between the snapshots, the first one at 100 holds no balance.
+	assert.Equal(t, "400,0", balanceAt(101, "bc1qa"))
+	assert.Equal(t, []string{"bc1qa:400,0", "bc1qb:400,0"}, holdersAt(101))
+	assert.Equal(t, "500,100", balanceAt(102, "bc1qa"))
+	// The holders are ordered by address.
+	assert.Equal(t, []string{"bc1qa:500,0", "bc1qb:400,0", "bc1qc:100,0"}, holdersAt(103))
+	_, err := s.BalanceAt(104, "ordi", "bc1qa")
+	assert.NotNil(t, err)
+
+	// The balances at the snapshot of 102 are read from it, and the events after it are replayed on it.
+	_, err = s.Db.Exec("delete from btc_ord_balance_event where block<=102")
+	assert.Nil(t, err)
+	assert.Equal(t, "500,100", balanceAt(102, "bc1qa"))
+	assert.Equal(t, "400,0", balanceAt(103, "bc1qb"))
+	assert.Equal(t, "500,0", balanceAt(103, "bc1qa"))
+	assert.Equal(t, []string{"bc1qa:500,100", "bc1qb:400,0"}, holdersAt(102))
+	assert.Equal(t, []string{"bc1qa:500,0", "bc1qb:400,0", "bc1qc:100,0"}, holdersAt(103))
+}
+
+func Test_HistoryBeforeJournal(t *testing.T) {
+	s := newTestValidator(t)
+	// The blocks to 102 were validated before the balance events were kept.
+	_, err := s.Db.Exec("update btc_ord_dict set value='102' where `key`='btc.ord.indexer.block'")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Run())
+	_, err = s.Db.Exec("delete from btc_ord_balance_event")
+	assert.Nil(t, err)
+	_, err = s.BalanceAt(102, "ordi", "bc1qa")
+	assert.NotNil(t, err)
+	_, err = s.HoldersAt(102, "ordi")
+	assert.NotNil(t, err)
+
+	// The journal starts with a snapshot of the balances at the validated block.
+	_, err = s.Db.Exec("update btc_ord_dict set value='103' where `key`='btc.ord.indexer.block'")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Run())
+	balance, err := s.BalanceAt(102, "ordi", "bc1qa")
+	assert.Nil(t, err)
+	assert.Equal(t, "500,100", balanceOf(balance))
+	balance, err = s.BalanceAt(103, "ordi", "bc1qa")
+	assert.Nil(t, err)
+	assert.Equal(t, "500,0", balanceOf(balance))
+	holders, err := s.HoldersAt(103, "ordi")
+	assert.Nil(t, err)
+	assert.Len(t, holders, 3)
+	_, err = s.BalanceAt(101, "ordi", "bc1qa")
+	assert.NotNil(t, err)
+	_, err = s.HoldersAt(101, "ordi")
+	assert.NotNil(t, err)
+}
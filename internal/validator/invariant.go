@@ -0,0 +1,68 @@
+package validator
+
+import (
+	"fmt"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Check verifies the invariants of the validated state of the ticks, or of all ticks if ticks is empty:
+// the sum of available and transferable balances of a tick equals its minted amount, no balance is negative
+// and the minted amount doesn't exceed the supply.
+func (s *Validator) Check(ticks []string) (violations []*engine.Violation, err error) {
+	return s.check(&dbState{Chain: s.Chain, Db: s.Db, Ctx: s.Ctx}, ticks)
+}
+
+// check: verify the invariants of the tables of the state, which are the shadow tables during revalidation.
+func (s *Validator) check(state *dbState, ticks []string) (violations []*engine.Violation, err error) {
+	_orm := s.newOrm()
+	var tickValues []any
+	for _, tick := range ticks {
+		tickValues = append(tickValues, tick)
+	}
+
+	tickMap := make(map[string]*models.Tick)
+	if err = _orm.EachPage(state.model("ord_tick").Bind(&models.Tick{}).WhereIn("Name", tickValues...), 2000, func(item any) error {
+		tick := item.(*models.Tick)
+		tickMap[strings.ToLower(tick.Name)] = tick
+		return nil
+	}); err != nil {
+		return
+	}
+	log.Printf("checking %d tick", len(tickMap))
+
+	sums := make(map[string]decimal.Decimal)
+	if err = _orm.EachPage(state.model("ord_address").Bind(&models.Address{}).WhereIn("Tick", tickValues...), 2000, func(item any) error {
+		address := item.(*models.Address)
+		key := strings.ToLower(address.Tick)
+		if tickMap[key] == nil {
+			violations = append(violations, &engine.Violation{Tick: address.Tick, Address: address.Address, Detail: "has balance of a tick not deployed"})
+			return nil
+		}
+		violations = append(violations, engine.CheckBalance(address)...)
+		sums[key] = sums[key].Add(conv.Decimal(address.Available)).Add(conv.Decimal(address.Transferable))
+		return nil
+	}); err != nil {
+		return
+	}
+
+	var keys []string
+	for key := range tickMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tick := tickMap[key]
+		violations = append(violations, engine.CheckMinted(tick)...)
+		if minted := conv.Decimal(tick.MintedAmount); !sums[key].Equal(minted) {
+			violations = append(violations, &engine.Violation{Tick: tick.Name, Detail: fmt.Sprintf("sum of balances:%s is not equal to minted:%s", sums[key].String(), minted.String())})
+		}
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package validator
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"libord/pkg/orm"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AddPatch forces the status and valid amount of the tx, the patch replaces the former one of the same tx.
+// The tick of the tx is revalidated if the tx has been validated.
+func (s *Validator) AddPatch(patch *models.Patch) (err error) {
+	if patch.Status != models.TxStatusValid && patch.Status != models.TxStatusInvalid {
+		err = errors.Errorf("status:%d not valid", patch.Status)
+		return
+	}
+	if patch.Reason == "" {
+		err = errors.Errorf("reason not allowed empty")
+		return
+	}
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	_m.Bind(&models.Tx{}).Where("TxId", patch.TxId).Where("InputIndex", patch.InputIndex)
+	if patch.Operation != "" {
+		_m.Where("Operation", patch.Operation)
+	}
+	var items []*models.Tx
+	if items, err = orm.Find[*models.Tx](_orm, _m); err != nil {
+		return
+	} else if len(items) == 0 {
+		err = errors.Errorf("tx:%s input:%d not found", patch.TxId, patch.InputIndex)
+		return
+	} else if len(items) > 1 {
+		err = errors.Errorf("tx:%s input:%d has %d ops, please specify the op", patch.TxId, patch.InputIndex, len(items))
+		return
+	}
+	tx := items[0]
+	patch.Operation, patch.Tick, patch.Block = tx.Operation, tx.Tick, tx.BlockHeight
+	patch.CreateTime = time.Now().Unix()
+
+	// The former patch of the tx is replaced by the same statement.
+	if _, _, err = _orm.Save((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(patch).BatchData(patch).Upsert("TxId", "Operation", "InputIndex")); err != nil {
+		return
+	}
+	log.Printf("patched tx:%s op:%s input:%d of tick:%s", patch.TxId, patch.Operation, patch.InputIndex, patch.Tick)
+	return s.revalidatePatched(patch)
+}
+
+// Patches returns the patches of the tick, or of all ticks if tick is empty.
+func (s *Validator) Patches(tick string) (ret []*models.Patch, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	_m.Bind(&models.Patch{})
+	if tick != "" {
+		_m.Where("Tick", tick)
+	}
+	err = _orm.EachPage(_m, 2000, func(item any) error {
+		ret = append(ret, item.(*models.Patch))
+		return nil
+	})
+	return
+}
+
+// RemovePatch deletes the patch of the tx, the tx is validated by the rules again.
+// The tick of the tx is revalidated if the tx has been validated.
+func (s *Validator) RemovePatch(txid, op string, inputIndex int) (err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	_m.Bind(&models.Patch{}).Where("TxId", txid).Where("InputIndex", inputIndex)
+	if op != "" {
+		_m.Where("Operation", op)
+	}
+	var items []*models.Patch
+	if items, err = orm.Find[*models.Patch](_orm, _m); err != nil {
+		return
+	} else if len(items) == 0 {
+		err = errors.Errorf("patch of tx:%s input:%d not found", txid, inputIndex)
+		return
+	} else if len(items) > 1 {
+		err = errors.Errorf("tx:%s input:%d has %d patches, please specify the op", txid, inputIndex, len(items))
+		return
+	}
+	patch := items[0]
+	// The forced result saved in ord_tx is replaced by the revalidation, see applyPatches.
+	if _, err = _orm.Delete((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(patch).Where("Id", patch.Id)); err != nil {
+		return
+	}
+	log.Printf("removed the patch of tx:%s op:%s input:%d of tick:%s", patch.TxId, patch.Operation, patch.InputIndex, patch.Tick)
+	return s.revalidatePatched(patch)
+}
+
+// revalidatePatched: revalidate the tick of the patch if its tx has been validated, otherwise the patch applies when the block is validated.
+// The live tables are only changed by the swap of the revalidation, an interrupted one is resumed by revalidating the tick again.
+func (s *Validator) revalidatePatched(patch *models.Patch) (err error) {
+	if validatorBlock := s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block"); patch.Block > validatorBlock {
+		log.Printf("block:%d not validated yet, the patch applies when it's validated", patch.Block)
+		return
+	}
+	if _, err = s.Revalidate(0, 0, []string{patch.Tick}, false); err != nil {
+		err = errors.Wrapf(err, "the patch is saved but tick:%s is not revalidated, resume it by revalidating the tick", patch.Tick)
+	}
+	return
+}
+
+// applyPatches: force the results of the txs of the block which are patched, the results forced by removed patches are
+// cleared so that the rules validate the txs again.
+func (s *Validator) applyPatches(block int64, txs []*models.Tx) (err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var items []*models.Patch
+	if items, err = orm.Find[*models.Patch](_orm, _m.Bind(&models.Patch{}).Where("Block", block)); err != nil {
+		return
+	}
+	patchMap := make(map[string]*models.Patch)
+	for _, patch := range items {
+		patchMap[strings.ToLower(fmt.Sprintf("%s,%s,%d", patch.TxId, patch.Operation, patch.InputIndex))] = patch
+	}
+	for _, tx := range txs {
+		if patch := patchMap[strings.ToLower(fmt.Sprintf("%s,%s,%d", tx.TxId, tx.Operation, tx.InputIndex))]; patch != nil {
+			tx.Status, tx.Reason, tx.ValidAmount = patch.Status, "patch:"+patch.Reason, patch.ValidAmount
+		} else if strings.Index(tx.Reason, "patch:") == 0 {
+			tx.Status, tx.Reason, tx.ValidAmount = models.TxStatusUnknown, "", ""
+		}
+	}
+	return
+}
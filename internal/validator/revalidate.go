@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// revalidateProgress is the checkpoint of a revalidation saved in the dict, an interrupted revalidation of the same ticks
+// resumes from the block after it.
+type revalidateProgress struct {
+	Ticks []string `json:"ticks"`
+	Start int64    `json:"start"`
+	Block int64    `json:"block"` // the last block saved into the shadow tables
+}
+
+func (s *Validator) progressDictKey() string {
+	return strings.ToLower(s.Chain) + ".ord.revalidator.progress"
+}
+
+// detectRange: the start is the block before the earliest deploy of the ticks, and the end is the validator checkpoint.
+func (s *Validator) detectRange(startBlock, endBlock int64, ticks []string) (int64, int64, error) {
+	if endBlock <= 0 {
+		endBlock = s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block")
+	}
+	if startBlock <= 0 {
+		_orm := s.newOrm()
+		_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+		for _, name := range ticks {
+			tick, err := orm.First[*models.Tick](_orm, _m.Bind(&models.Tick{}).Where("Name", name))
+			if err != nil {
+				return 0, 0, err
+			} else if tick == nil {
+				return 0, 0, errors.Errorf("tick:%s not found", name)
+			}
+			deployTx, err := orm.First[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", tick.DeployTx).Where("Operation", "deploy"))
+			if err != nil {
+				return 0, 0, err
+			} else if deployTx == nil {
+				return 0, 0, errors.Errorf("deploy tx:%s of tick:%s not found", tick.DeployTx, name)
+			}
+			if height := deployTx.BlockHeight - 1; startBlock <= 0 || height < startBlock {
+				startBlock = height
+			}
+		}
+	}
+	if startBlock >= endBlock {
+		return 0, 0, errors.Errorf("start block:%d is not before end block:%d", startBlock, endBlock)
+	}
+	return startBlock, endBlock, nil
+}
+
+// loadProgress: the checkpoint of an interrupted revalidation of the same ticks from the same start, nil if there is none.
+func (s *Validator) loadProgress(startBlock int64, ticks []string) (progress *revalidateProgress, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var value any
+	if value, err = _orm.One(_m.Bind(&models.Dict{}).Where("Key", s.progressDictKey()), "value"); err != nil || conv.String(value) == "" {
+		return
+	}
+	saved := &revalidateProgress{}
+	conv.Struct(conv.Map(conv.String(value)), saved)
+	sort.Strings(saved.Ticks)
+	if saved.Start != startBlock || strings.Join(saved.Ticks, ",") != strings.Join(ticks, ",") {
+		log.Printf("found progress of another revalidation, ticks:%s start:%d, starting over", strings.Join(saved.Ticks, ","), saved.Start)
+		return
+	}
+	progress = saved
+	return
+}
+
+func (s *Validator) saveProgress(_orm *orm.Orm, progress *revalidateProgress) (err error) {
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var affected int64
+	if affected, err = _orm.Update(_m.Bind(&models.Dict{}).Update("Value", conv.String(progress)).Where("Key", s.progressDictKey())); err != nil || affected > 0 {
+		return
+	}
+	obj := &models.Dict{Key: s.progressDictKey(), Value: conv.String(progress)}
+	_, _, err = _orm.Save((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(obj).BatchData(obj))
+	return
+}
+
+func (s *Validator) deleteProgress() (err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	_, err = _orm.Delete(_m.Bind(&models.Dict{}).Where("Key", s.progressDictKey()))
+	return
+}
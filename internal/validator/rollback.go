@@ -0,0 +1,173 @@
+package validator
+
+import (
+	"fmt"
+	"libord/internal/models"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Rollback undoes the validation of the blocks after the block, so that they can be indexed and validated again.
+// The balances and minted amounts are unwound by the balance events after the block, and all changes are written in one
+// transaction, i.e., an interrupted rollback can be run again. If revalidate is set, the ticks changed after the block
+// are revalidated up to it in the shadow tables instead, and the rollback is written with their swap, e.g: the balance events
+// of the blocks before the journal was kept are missing, the rollback is refused without revalidate in that case.
+func (s *Validator) Rollback(block int64, revalidate bool) (err error) {
+	validatorDictKey := strings.ToLower(s.Chain) + ".ord.validator.block"
+	validatorBlock := s.getDictValue(validatorDictKey)
+	if validatorBlock <= block {
+		log.Printf("validated block:%d is not after block:%d, nothing to roll back", validatorBlock, block)
+		return
+	}
+	log.Printf("rolling back validated blocks from %d to %d", validatorBlock, block+1)
+	// The cached state of Run is ahead of the block.
+	s.state = nil
+
+	prefix := strings.ToLower(s.Chain) + "_"
+	var ticks []string
+	if revalidate {
+		if ticks, err = s.changedTicks(block); err != nil {
+			return
+		}
+	}
+	var statements []statement
+	addStatement := func(query string, args ...any) {
+		statements = append(statements, statement{fmt.Sprintf(query, prefix), args})
+	}
+	if !revalidate {
+		var balances []*models.Address
+		if balances, err = s.unwoundBalances(block); err != nil {
+			return
+		}
+		for _, balance := range balances {
+			addStatement("update %sord_address set available=?,transferable=?,block=? where tick=? and address=?", balance.Available, balance.Transferable, balance.BlockAtUpdate, balance.Tick, balance.Address)
+		}
+		var unwoundTicks []*models.Tick
+		if unwoundTicks, err = s.unwoundTicks(block); err != nil {
+			return
+		}
+		for _, tick := range unwoundTicks {
+			addStatement("update %sord_tick set minted=?,finish_mint_tx=?,finish_mint_time=? where id=?", tick.MintedAmount, tick.FinishMintTx, tick.FinishMintTime, tick.Id)
+		}
+	}
+	// The ticks deployed after the block are dropped by the indexer, so are their balances.
+	addStatement("delete from %[1]sord_address where tick in (select t.name from %[1]sord_tick t join %[1]sord_tx d on d.txid=t.deploy_tx and d.op='deploy' where d.block_height>?)", block)
+	// The changes after the block are skipped by their block otherwise.
+	addStatement("update %sord_address set block=? where block>?", block, block)
+	addStatement("update %sord_tick set block=? where block>?", block, block)
+	addStatement("update %sord_tx set status=?,reason='',valid_amt='' where block_height>?", models.TxStatusUnknown, block)
+	addStatement("delete from %sord_balance_event where block>?", block)
+	addStatement("delete from %sord_balance_snapshot where block>?", block)
+	addStatement("delete from %sord_block_hash where block>?", block)
+	addStatement("update %sord_dict set value=? where `key`=?", conv.String(block), validatorDictKey)
+
+	if len(ticks) > 0 {
+		// The checkpoint is reset along with the swap of the revalidated ticks, an interrupted revalidation leaves the live
+		// tables as they were, and the rollback resumes it when it's run again.
+		if _, err = s.revalidate(0, block, ticks, false, statements); err != nil {
+			return
+		}
+	} else {
+		dialect := orm.DialectOf(s.Db)
+		tx, _err := s.Db.BeginTx(s.context(), nil)
+		if _err != nil {
+			err = _err
+			return
+		}
+		for _, statement := range statements {
+			if _, err = tx.ExecContext(s.context(), dialect.Rebind(statement.query), statement.args...); err != nil {
+				_ = tx.Rollback()
+				return
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return
+		}
+	}
+	log.Printf("rolled back validated blocks to %d", block)
+	return
+}
+
+// unwoundBalances: the balances at the block of the addresses changed after it.
+func (s *Validator) unwoundBalances(block int64) (ret []*models.Address, err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	_orm := s.newOrm()
+	var items []any
+	if items, err = _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select distinct tick,address from %sord_balance_event where block>?", prefix), block)); err != nil {
+		return
+	}
+	log.Printf("unwinding %d balances", len(items))
+	covered := make(map[string]bool)
+	for _, item := range items {
+		m := item.(map[string]any)
+		if tick := conv.String(m["tick"]); !covered[tick] {
+			if covered[tick], err = s.journalCovers(block, tick); err != nil {
+				return
+			} else if !covered[tick] {
+				err = errors.Errorf("the balance events of tick:%s don't cover block:%d, roll back with revalidate instead", tick, block)
+				return
+			}
+		}
+		var balance *models.Address
+		if balance, err = s.balanceAt(block, conv.String(m["tick"]), conv.String(m["address"])); err != nil {
+			return
+		}
+		if balance.Available == "" {
+			balance.Available = "0"
+		}
+		if balance.Transferable == "" {
+			balance.Transferable = "0"
+		}
+		ret = append(ret, balance)
+	}
+	return
+}
+
+// unwoundTicks: the ticks minted after the block, with the amounts minted after it subtracted.
+func (s *Validator) unwoundTicks(block int64) (ret []*models.Tick, err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	minted := make(map[string]decimal.Decimal)
+	mintTxs := make(map[string]bool)
+	if err = _orm.EachPage(_m.Bind(&models.BalanceEvent{}).Where("Operation", "mint").WhereGT("Block", block), 2000, func(item any) error {
+		event := item.(*models.BalanceEvent)
+		key := strings.ToLower(event.Tick)
+		minted[key] = minted[key].Add(conv.Decimal(event.AvailableDelta))
+		mintTxs[event.TxId] = true
+		return nil
+	}); err != nil {
+		return
+	}
+	for name, amount := range minted {
+		if tick, _err := orm.First[*models.Tick](_orm, _m.Bind(&models.Tick{}).Where("Name", name)); _err != nil {
+			err = _err
+			return
+		} else if tick != nil {
+			tick.MintedAmount = conv.Decimal(tick.MintedAmount).Sub(amount).String()
+			if mintTxs[tick.FinishMintTx] {
+				tick.FinishMintTx, tick.FinishMintTime = "", 0
+			}
+			ret = append(ret, tick)
+		}
+	}
+	return
+}
+
+// changedTicks: the ticks with valid txs after the block, except those deployed after it.
+func (s *Validator) changedTicks(block int64) (ticks []string, err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	_orm := s.newOrm()
+	var items []any
+	if items, err = _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select distinct t.name from %[1]sord_tx x join %[1]sord_tick t on t.name=x.tick join %[1]sord_tx d on d.txid=t.deploy_tx and d.op='deploy' where x.block_height>? and x.status=? and d.block_height<=?", prefix), block, models.TxStatusValid, block)); err != nil {
+		return
+	}
+	for _, item := range items {
+		ticks = append(ticks, conv.String(item.(map[string]any)["name"]))
+	}
+	return
+}
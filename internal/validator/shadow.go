@@ -0,0 +1,179 @@
+package validator
+
+import (
+	"fmt"
+	"libord/pkg/conv"
+	"libord/pkg/orm"
+	"log"
+	"strings"
+)
+
+// shadowSuffix is the suffix of the shadow tables written by revalidation, e.g: btc_ord_tick_shadow.
+const shadowSuffix = "_shadow"
+
+// Change is a difference between the revalidated shadow tables and the live tables.
+type Change struct {
+	Table string // tick, address or tx
+	Key   string // tick name, tick and address, or txid and input index
+	Old   string
+	New   string
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s %s: %s => %s", c.Table, c.Key, c.Old, c.New)
+}
+
+// createShadow: copy the ticks and their addresses into the emptied shadow tables with the minted amounts and balances reset,
+// i.e., the balances are calculated from beginning.
+func (s *Validator) createShadow(ticks []string) (err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	rebind := orm.DialectOf(s.Db).Rebind
+	holders := strings.TrimSuffix(strings.Repeat("?,", len(ticks)), ",")
+	var args []any
+	for _, tick := range ticks {
+		args = append(args, tick)
+	}
+	if err = s.dropShadow(); err != nil {
+		return
+	}
+	tickColumns := "id,name,`dec`,supply,mint_limit,minted,deploy_tx,deploy_pos,deploy_by,deploy_time,finish_mint_time,finish_mint_tx,block"
+	if _, err = s.Db.ExecContext(s.context(), rebind(fmt.Sprintf("insert into %sord_tick%s(%s) select %s from %sord_tick where name in (%s)", prefix, shadowSuffix, tickColumns, tickColumns, prefix, holders)), args...); err != nil {
+		return
+	}
+	if _, err = s.Db.ExecContext(s.context(), fmt.Sprintf("update %sord_tick%s set minted='0',finish_mint_tx='',finish_mint_time=0,block=0", prefix, shadowSuffix)); err != nil {
+		return
+	}
+	// The ids of the addresses are not copied, the shadow table generates its own ones for the new addresses.
+	if _, err = s.Db.ExecContext(s.context(), rebind(fmt.Sprintf("insert into %sord_address%s(address,tick,available,transferable,block) select address,tick,'','',0 from %sord_address where tick in (%s)", prefix, shadowSuffix, prefix, holders)), args...); err != nil {
+		return
+	}
+	return
+}
+
+// dropShadow: empty the shadow tables, which are created by the migrations.
+func (s *Validator) dropShadow() (err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	for _, table := range []string{"ord_tick", "ord_address", "ord_balance_event", "ord_tx"} {
+		if _, err = s.Db.ExecContext(s.context(), fmt.Sprintf("delete from %s%s%s", prefix, table, shadowSuffix)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// diffShadow: list the ticks, balances and tx statuses which the revalidation changes.
+func (s *Validator) diffShadow() (changes []*Change, err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	_orm := s.newOrm()
+	limit := 2000
+
+	if items, _err := _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select s.name,l.minted as old_minted,s.minted,l.finish_mint_tx as old_finish_mint_tx,s.finish_mint_tx from %sord_tick%s s join %sord_tick l on l.id=s.id order by s.id asc", prefix, shadowSuffix, prefix))); _err != nil {
+		err = _err
+		return
+	} else {
+		for _, item := range items {
+			m := item.(map[string]any)
+			oldValue := fmt.Sprintf("minted:%s finish_mint_tx:%s", conv.Decimal(m["old_minted"]).String(), conv.String(m["old_finish_mint_tx"]))
+			newValue := fmt.Sprintf("minted:%s finish_mint_tx:%s", conv.Decimal(m["minted"]).String(), conv.String(m["finish_mint_tx"]))
+			if oldValue != newValue {
+				changes = append(changes, &Change{Table: "tick", Key: conv.String(m["name"]), Old: oldValue, New: newValue})
+			}
+		}
+	}
+
+	startId := int64(0)
+	for {
+		if items, _err := _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select s.id,s.tick,s.address,l.available as old_available,s.available,l.transferable as old_transferable,s.transferable from %sord_address%s s left join %sord_address l on l.tick=s.tick and l.address=s.address where s.id>? order by s.id asc limit ?", prefix, shadowSuffix, prefix), startId, limit)); _err != nil {
+			err = _err
+			return
+		} else {
+			for _, item := range items {
+				m := item.(map[string]any)
+				startId = conv.Int64(m["id"])
+				oldValue := fmt.Sprintf("available:%s transferable:%s", conv.Decimal(m["old_available"]).String(), conv.Decimal(m["old_transferable"]).String())
+				newValue := fmt.Sprintf("available:%s transferable:%s", conv.Decimal(m["available"]).String(), conv.Decimal(m["transferable"]).String())
+				if oldValue != newValue {
+					changes = append(changes, &Change{Table: "address", Key: fmt.Sprintf("%s,%s", m["tick"], m["address"]), Old: oldValue, New: newValue})
+				}
+			}
+			if len(items) < limit {
+				break
+			}
+		}
+	}
+
+	startId = 0
+	for {
+		if items, _err := _orm.Find((&orm.Model{}).Extra(fmt.Sprintf("select s.id,l.txid,l.input_idx,l.status as old_status,s.status,l.valid_amt as old_valid_amt,s.valid_amt,s.reason from %sord_tx%s s join %sord_tx l on l.id=s.tx_row_id where s.id>? order by s.id asc limit ?", prefix, shadowSuffix, prefix), startId, limit)); _err != nil {
+			err = _err
+			return
+		} else {
+			for _, item := range items {
+				m := item.(map[string]any)
+				startId = conv.Int64(m["id"])
+				oldValue := fmt.Sprintf("status:%s valid_amt:%s", conv.String(m["old_status"]), conv.String(m["old_valid_amt"]))
+				newValue := fmt.Sprintf("status:%s valid_amt:%s", conv.String(m["status"]), conv.String(m["valid_amt"]))
+				if oldValue != newValue {
+					if reason := conv.String(m["reason"]); reason != "" {
+						newValue += " reason:" + reason
+					}
+					changes = append(changes, &Change{Table: "tx", Key: fmt.Sprintf("%s:%s", m["txid"], m["input_idx"]), Old: oldValue, New: newValue})
+				}
+			}
+			if len(items) < limit {
+				break
+			}
+		}
+	}
+	return
+}
+
+// statement is a query with its args, which are written in one transaction with the others.
+type statement struct {
+	query string
+	args  []any
+}
+
+// swapShadow: replace the live data of the ticks with the shadow tables in one transaction, so that readers never see
+// half-revalidated balances. The journal and state hashes after startBlock are replaced along with them, the snapshots are dropped.
+// The statements of a rollback to endBlock, if any, are written first in the same transaction.
+func (s *Validator) swapShadow(startBlock, endBlock int64, ticks []string, rollback []statement) (err error) {
+	prefix := strings.ToLower(s.Chain) + "_"
+	holders := strings.TrimSuffix(strings.Repeat("?,", len(ticks)), ",")
+	var args []any
+	for _, tick := range ticks {
+		args = append(args, tick)
+	}
+	args = append(args, startBlock)
+	dialect := orm.DialectOf(s.Db)
+	statements := append(rollback, []statement{
+		{dialect.UpdateJoin(prefix+"ord_tick", "l", prefix+"ord_tick"+shadowSuffix+" s", "l.id=s.id", "minted=s.minted", "finish_mint_tx=s.finish_mint_tx", "finish_mint_time=s.finish_mint_time", "block=s.block"), nil},
+		{dialect.UpdateJoin(prefix+"ord_address", "l", prefix+"ord_address"+shadowSuffix+" s", "l.tick=s.tick and l.address=s.address", "available=s.available", "transferable=s.transferable", "block=s.block"), nil},
+		{fmt.Sprintf("insert into %[1]sord_address(address,tick,available,transferable,block) select address,tick,available,transferable,block from %[1]sord_address%[2]s s where not exists (select 1 from %[1]sord_address l where l.tick=s.tick and l.address=s.address)", prefix, shadowSuffix), nil},
+		{dialect.UpdateJoin(prefix+"ord_tx", "l", prefix+"ord_tx"+shadowSuffix+" s", "l.id=s.tx_row_id", "status=s.status", "reason=s.reason", "valid_amt=s.valid_amt"), nil},
+		{fmt.Sprintf("delete from %sord_balance_event where tick in (%s) and block>?", prefix, holders), args},
+		{fmt.Sprintf("insert into %sord_balance_event(txid,op,input_idx,address,tick,available_delta,transferable_delta,available,transferable,block,pos) select txid,op,input_idx,address,tick,available_delta,transferable_delta,available,transferable,block,pos from %sord_balance_event%s where block>? order by id", prefix, prefix, shadowSuffix), []any{startBlock}},
+		{fmt.Sprintf("delete from %sord_balance_snapshot where tick in (%s) and block>?", prefix, holders), args},
+	}...)
+
+	tx, err := s.Db.BeginTx(s.context(), nil)
+	if err != nil {
+		return
+	}
+	for _, statement := range statements {
+		if _, err = tx.ExecContext(s.context(), dialect.Rebind(statement.query), statement.args...); err != nil {
+			_ = tx.Rollback()
+			return
+		}
+	}
+	// The state commitments after startBlock were computed from the balances being replaced, chain them again from the swapped ones.
+	if err = s.rehashBlocks(tx, startBlock, endBlock); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	log.Printf("swapped the shadow tables of ticks:%s", conv.String(ticks))
+	return s.dropShadow()
+}
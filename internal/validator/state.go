@@ -0,0 +1,341 @@
+package validator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"libord/config"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"libord/pkg/lru"
+	"libord/pkg/orm"
+	"libord/pkg/slice"
+	"log"
+	"strings"
+	"sync"
+)
+
+// defaultStateCacheSize is the number of ticks and addresses kept in memory if the cache size isn't configured.
+const defaultStateCacheSize = 1000000
+
+// dbState is the engine state backed by the database. The ticks and balances touched by a block are loaded in batches
+// before validating it, and kept in a size-bounded cache after the changes are written back.
+type dbState struct {
+	Chain       string
+	Db          *sql.DB
+	Ctx         context.Context
+	TableSuffix string // read and write the shadow tables of ticks, addresses, balance events and tx statuses if not empty
+
+	tickCache    *lru.Cache[string, *models.Tick]
+	addressCache *lru.Cache[string, *models.Address]
+
+	// The ticks and addresses read since the last commit, they are never evicted so that the engine always gets the
+	// same object of them until the changes are written back. A nil tick means it has not been deployed.
+	pendingTicks     map[string]*models.Tick
+	pendingAddresses map[string]*models.Address
+	mu               sync.Mutex
+
+	block int64 // the block committed last, the cache is stale if the checkpoint is moved away from it by others
+}
+
+func newDbState(ctx context.Context, chain string, db *sql.DB, tableSuffix string) *dbState {
+	cacheSize := config.Instance().StateCacheSize[strings.ToLower(chain)]
+	if cacheSize <= 0 {
+		cacheSize = defaultStateCacheSize
+	}
+	return &dbState{
+		Chain:            chain,
+		Db:               db,
+		Ctx:              ctx,
+		TableSuffix:      tableSuffix,
+		tickCache:        lru.New[string, *models.Tick](cacheSize / 10),
+		addressCache:     lru.New[string, *models.Address](cacheSize),
+		pendingTicks:     make(map[string]*models.Tick),
+		pendingAddresses: make(map[string]*models.Address),
+	}
+}
+
+// newOrm: an orm whose calls are cancelled with the Ctx of the state, or by the db timeout.
+func (s *dbState) newOrm() *orm.Orm {
+	return &orm.Orm{Db: s.Db, Ctx: s.Ctx, Timeout: config.Instance().DbTimeout()}
+}
+
+// model: a model of the table, which is replaced by its shadow table if TableSuffix is set.
+func (s *dbState) model(table string) *orm.Model {
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	if s.TableSuffix != "" {
+		_m.Table(table + s.TableSuffix)
+	}
+	return _m
+}
+
+// prefetch: load the ticks and addresses of the txs which are not in memory in batches.
+func (s *dbState) prefetch(txs []*models.Tx) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_orm := s.newOrm()
+
+	var tickNames []any
+	for _, tx := range txs {
+		if key := strings.ToLower(tx.Tick); !s.cachedTick(key) && !slice.Contains(tickNames, any(key)) {
+			tickNames = append(tickNames, key)
+		}
+	}
+	for parti := range slice.Partition(len(tickNames), 500) {
+		if items, _err := orm.Find[*models.Tick](_orm, s.model("ord_tick").Bind(&models.Tick{}).WhereIn("Name", tickNames[parti.Low:parti.High]...)); _err != nil {
+			err = _err
+			return
+		} else {
+			for _, tick := range items {
+				s.pendingTicks[strings.ToLower(tick.Name)] = tick
+			}
+		}
+		for _, name := range tickNames[parti.Low:parti.High] {
+			if _, ok := s.pendingTicks[name.(string)]; !ok {
+				s.pendingTicks[name.(string)] = nil
+			}
+		}
+	}
+
+	// The addresses are queried by address, the rows of other ticks of the addresses are dropped.
+	missing := make(map[string]*models.Address)
+	var addresses, ticks []any
+	for _, tx := range txs {
+		tick := s.pendingTicks[strings.ToLower(tx.Tick)]
+		if tick == nil {
+			continue
+		}
+		for _, address := range []string{tx.From, tx.To} {
+			if key := addressKey(tick.Name, address); address != "" && !s.cachedAddress(key) && missing[key] == nil {
+				missing[key] = &models.Address{Tick: tick.Name, Address: address}
+				addresses = append(addresses, address)
+				if !slice.Contains(ticks, any(tick.Name)) {
+					ticks = append(ticks, tick.Name)
+				}
+			}
+		}
+	}
+	for parti := range slice.Partition(len(addresses), 500) {
+		if items, _err := orm.Find[*models.Address](_orm, s.model("ord_address").Bind(&models.Address{}).WhereIn("Tick", ticks...).WhereIn("Address", addresses[parti.Low:parti.High]...)); _err != nil {
+			err = _err
+			return
+		} else {
+			for _, address := range items {
+				if key := addressKey(address.Tick, address.Address); missing[key] != nil {
+					missing[key] = address
+				}
+			}
+		}
+	}
+	for key, address := range missing {
+		s.pendingAddresses[key] = address
+	}
+	return
+}
+
+// cachedTick: move the tick into the pending ones if it's in memory.
+func (s *dbState) cachedTick(key string) bool {
+	if _, ok := s.pendingTicks[key]; ok {
+		return true
+	}
+	if tick, ok := s.tickCache.Get(key); ok {
+		s.pendingTicks[key] = tick
+		return true
+	}
+	return false
+}
+
+// cachedAddress: move the address into the pending ones if it's in memory.
+func (s *dbState) cachedAddress(key string) bool {
+	if _, ok := s.pendingAddresses[key]; ok {
+		return true
+	}
+	if address, ok := s.addressCache.Get(key); ok {
+		s.pendingAddresses[key] = address
+		return true
+	}
+	return false
+}
+
+func (s *dbState) Tick(name string) (*models.Tick, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name)
+	if !s.cachedTick(key) {
+		_orm := s.newOrm()
+		tick, err := orm.First[*models.Tick](_orm, s.model("ord_tick").Bind(&models.Tick{}).Where("Name", name))
+		if err != nil {
+			return nil, err
+		}
+		s.pendingTicks[key] = tick
+	}
+	return s.pendingTicks[key], nil
+}
+
+func (s *dbState) Address(tick, address string) (*models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := addressKey(tick, address)
+	if !s.cachedAddress(key) {
+		_orm := s.newOrm()
+		item, err := orm.First[*models.Address](_orm, s.model("ord_address").Bind(&models.Address{}).Where("Tick", tick).Where("Address", address))
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			item = &models.Address{Tick: tick, Address: address}
+		}
+		s.pendingAddresses[key] = item
+	}
+	return s.pendingAddresses[key], nil
+}
+
+func (s *dbState) ValidInscribeTransfer(txid, tick string) (bool, error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	if s.TableSuffix == "" {
+		count, err := orm.Count(_orm, _m.Bind(&models.Tx{}).Where("TxId", txid).Where("Operation", "inscribe-transfer").Where("Tick", tick).Where("Status", models.TxStatusValid))
+		return count > 0, err
+	}
+	// The status revalidated in the shadow table takes precedence over the live one.
+	items, err := orm.Find[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", txid).Where("Operation", "inscribe-transfer").Where("Tick", tick))
+	if err != nil {
+		return false, err
+	}
+	for _, tx := range items {
+		status := tx.Status
+		if shadow, _err := orm.First[*models.TxShadow](_orm, s.model("ord_tx").Bind(&models.TxShadow{}).Where("TxRowId", tx.Id)); _err != nil {
+			return false, _err
+		} else if shadow != nil {
+			status = shadow.Status
+		}
+		if status == models.TxStatusValid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *dbState) Commit(result *engine.Result) error {
+	return s.commit(result, nil)
+}
+
+// commit: write the changes of the block back in one transaction, along with what save writes through the orm of it,
+// e.g: the block hash and the checkpoint, so that a crash never leaves a block written halfway.
+func (s *dbState) commit(result *engine.Result, save func(_orm *orm.Orm) error) (err error) {
+	ctx := s.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	_orm := s.newOrm()
+	_orm.Tx = tx
+	if err = s.write(_orm, result); err == nil && save != nil {
+		err = save(_orm)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	// All changes are written back, the pending ones can be evicted now.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, tick := range s.pendingTicks {
+		if tick != nil {
+			s.tickCache.Add(key, tick)
+		}
+	}
+	for key, address := range s.pendingAddresses {
+		s.addressCache.Add(key, address)
+	}
+	s.pendingTicks = make(map[string]*models.Tick)
+	s.pendingAddresses = make(map[string]*models.Address)
+	s.block = result.Block
+	return
+}
+
+// write: the tx statuses, ticks, addresses and balance events of the block through _orm.
+func (s *dbState) write(_orm *orm.Orm, result *engine.Result) (err error) {
+	// The forced status of the patches is saved along with the validated txs.
+	validated := append(append([]*models.Tx{}, result.Txs...), result.Patches...)
+	log.Printf("updating %d tx", len(validated))
+	var txs []any
+	for _, tx := range validated {
+		txs = append(txs, tx)
+	}
+	if s.TableSuffix != "" {
+		if err = s.saveTxShadows(_orm, validated); err != nil {
+			return
+		}
+	} else if err = _orm.BulkUpdate(s.model("ord_tx").Bind(&models.Tx{}).BatchData(txs...).Overwrite("Status", "Reason", "ValidAmount"), 500, true); err != nil {
+		return
+	}
+
+	log.Printf("updating %d tick", len(result.Ticks))
+	var ticks []any
+	for _, tick := range result.Ticks {
+		ticks = append(ticks, tick)
+	}
+	if err = _orm.BulkUpdate(s.model("ord_tick").Bind(&models.Tick{}).BatchData(ticks...).Overwrite("MintedAmount", "FinishMintTx", "FinishMintTime", "BlockAtUpdate"), 500, true); err != nil {
+		return
+	}
+
+	// The new addresses are inserted and the others are overwritten.
+	log.Printf("updating %d address", len(result.Addresses))
+	for parti := range slice.Partition(len(result.Addresses), 500) {
+		var addresses []any
+		for _, address := range result.Addresses[parti.Low:parti.High] {
+			addresses = append(addresses, address)
+		}
+		if _, _, err = _orm.Save(s.model("ord_address").Bind(&models.Address{}).BatchData(addresses...).Upsert("Address", "Tick").Overwrite("Available", "Transferable", "BlockAtUpdate")); err != nil {
+			return
+		}
+	}
+
+	log.Printf("saving %d balance event", len(result.Events))
+	err = s.saveBalanceEvents(_orm, result.Events)
+	return
+}
+
+func addressKey(tick, address string) string {
+	return strings.ToLower(fmt.Sprintf("%s,%s", tick, address))
+}
+
+// saveBalanceEvents: append the events to the journal, an event already saved by an interrupted run is ignored.
+func (s *dbState) saveBalanceEvents(_orm *orm.Orm, events []*models.BalanceEvent) (err error) {
+	for parti := range slice.Partition(len(events), 500) {
+		var items []any
+		for _, event := range events[parti.Low:parti.High] {
+			items = append(items, event)
+		}
+		if _, _, err = _orm.Save(s.model("ord_balance_event").Bind(&models.BalanceEvent{}).BatchData(items...)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// saveTxShadows: save the validation results of the txs into the shadow table, replacing the results saved by an interrupted run.
+func (s *dbState) saveTxShadows(_orm *orm.Orm, txs []*models.Tx) (err error) {
+	for parti := range slice.Partition(len(txs), 500) {
+		var ids, items []any
+		for _, tx := range txs[parti.Low:parti.High] {
+			ids = append(ids, tx.Id)
+			items = append(items, &models.TxShadow{TxRowId: tx.Id, Status: tx.Status, Reason: tx.Reason, ValidAmount: tx.ValidAmount})
+		}
+		if _, err = _orm.Delete(s.model("ord_tx").Bind(&models.TxShadow{}).WhereIn("TxRowId", ids...)); err != nil {
+			return
+		}
+		if _, _, err = _orm.Save(s.model("ord_tx").Bind(&models.TxShadow{}).BatchData(items...)); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,131 @@
+package validator
+
+import (
+	"fmt"
+	"libord/config"
+	"libord/internal/engine"
+	"libord/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DbStateLazyLoad(t *testing.T) {
+	s := newTestValidator(t)
+	state := newDbState(nil, s.Chain, s.Db, "")
+
+	tick, err := state.Tick("ordi")
+	assert.Nil(t, err)
+	assert.Equal(t, "ordi", tick.Name)
+	none, err := state.Tick("none")
+	assert.Nil(t, err)
+	assert.Nil(t, none)
+	address, err := state.Address("ordi", "bc1qa")
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Address{Tick: "ordi", Address: "bc1qa"}, address)
+
+	// The rows are read once, the engine gets the same objects until they are evicted.
+	_, err = s.Db.Exec("update btc_ord_tick set minted='1' where name='ordi'")
+	assert.Nil(t, err)
+	again, err := state.Tick("ordi")
+	assert.Nil(t, err)
+	assert.Same(t, tick, again)
+	assert.Nil(t, state.Commit(&engine.Result{Block: 100}))
+	again, err = state.Tick("ordi")
+	assert.Nil(t, err)
+	assert.Same(t, tick, again)
+	assert.Equal(t, "0", again.MintedAmount)
+}
+
+func Test_DbStateEviction(t *testing.T) {
+	cacheSize := config.Instance().StateCacheSize
+	config.Instance().StateCacheSize = map[string]int{"btc": 10}
+	defer func() {
+		config.Instance().StateCacheSize = cacheSize
+	}()
+	s := newTestValidator(t)
+	state := newDbState(nil, s.Chain, s.Db, "")
+
+	// The addresses changed by a block are never evicted before they are written back, however small the cache is.
+	var txs []*models.Tx
+	for i := 0; i < 30; i++ {
+		txs = append(txs, &models.Tx{Tick: "ordi", To: fmt.Sprintf("bc1q%d", i)})
+	}
+	assert.Nil(t, state.prefetch(txs))
+	result := &engine.Result{Block: 101}
+	var addresses []*models.Address
+	for _, tx := range txs {
+		address, err := state.Address("ordi", tx.To)
+		assert.Nil(t, err)
+		address.Available = "1"
+		addresses = append(addresses, address)
+		result.Addresses = append(result.Addresses, address)
+	}
+	for i, tx := range txs {
+		address, err := state.Address("ordi", tx.To)
+		assert.Nil(t, err)
+		assert.Same(t, addresses[i], address)
+	}
+	assert.Nil(t, state.Commit(result))
+	assert.Equal(t, int64(101), state.block)
+
+	// Only the cache size is kept after the commit, the evicted ones are read again with the changes written back.
+	assert.Equal(t, 10, state.addressCache.Len())
+	var evicted int
+	for i, tx := range txs {
+		address, err := state.Address("ordi", tx.To)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", address.Available)
+		if address != addresses[i] {
+			evicted++
+		}
+	}
+	assert.Equal(t, 20, evicted)
+}
+
+func Test_DbStateCommit(t *testing.T) {
+	s := newTestValidator(t)
+	state := newDbState(nil, s.Chain, s.Db, "")
+	tick, err := state.Tick("ordi")
+	assert.Nil(t, err)
+	address, err := state.Address("ordi", "bc1qa")
+	assert.Nil(t, err)
+	tick.MintedAmount, tick.BlockAtUpdate = "400", 101
+	address.Available, address.BlockAtUpdate = "400", 101
+	result := &engine.Result{Block: 101, Ticks: []*models.Tick{tick}, Addresses: []*models.Address{address},
+		Events: []*models.BalanceEvent{{TxId: "ordi1", Operation: "mint", Address: "bc1qa", Tick: "ordi", AvailableDelta: "400", TransferableDelta: "0", Available: "400", Transferable: "0", Block: 101}}}
+	assert.Nil(t, state.Commit(result))
+	// An interrupted block is committed again without duplicating the events.
+	assert.Nil(t, state.Commit(result))
+
+	assert.Equal(t, map[string]string{"bc1qa": "400,0"}, balances(t, s, "ordi"))
+	var minted string
+	assert.Nil(t, s.Db.QueryRow("select minted from btc_ord_tick where name='ordi'").Scan(&minted))
+	assert.Equal(t, "400", minted)
+	var count int
+	assert.Nil(t, s.Db.QueryRow("select count(*) from btc_ord_balance_event").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func Test_ValidatorKeepsState(t *testing.T) {
+	s := newTestValidator(t)
+	_, err := s.Db.Exec("update btc_ord_dict set value='102' where `key`='btc.ord.indexer.block'")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Run())
+	state := s.state
+	assert.NotNil(t, state)
+
+	_, err = s.Db.Exec("update btc_ord_dict set value='103' where `key`='btc.ord.indexer.block'")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Run())
+	assert.Same(t, state, s.state)
+
+	// A diff keeps the state of the live tables, a swap replaces the tables under it.
+	_, err = s.Revalidate(0, 0, []string{"ordi"}, true)
+	assert.Nil(t, err)
+	assert.Same(t, state, s.state)
+	assert.Nil(t, s.validateTicks)
+	_, err = s.Revalidate(0, 0, []string{"ordi"}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, s.state)
+}
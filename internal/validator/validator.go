@@ -1,36 +1,60 @@
 package validator
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"libord/config"
+	"libord/internal/engine"
 	"libord/internal/models"
 	"libord/pkg/conv"
 	"libord/pkg/orm"
 	"libord/pkg/slice"
 	"log"
+	"sort"
 	"strings"
-	"sync"
 
 	"github.com/pkg/errors"
-	"github.com/shopspring/decimal"
 )
 
+// Validator is the database adapter of the validation engine, it reads the txs of blocks from the database
+// and writes the validated results back.
 type Validator struct {
 	Chain string
 	Db    *sql.DB
+	Ctx   context.Context // the queries are cancelled with it, e.g: on signals, context.Background() if nil
 
-	tickMap    map[string]*models.Tick
-	addressMap map[string]*models.Address
+	CheckInvariants bool // check the invariants on the changes of every block, stop if any is broken
+	Workers         int  // number of ticks validated concurrently in a block
+
+	state *dbState // kept across runs, it's dropped when the live tables are changed by a revalidation or rollback
 
 	validateTicks []string // the ticks which need to be validated
 }
 
+// context: the Ctx of the validator, context.Background() if nil.
+func (s *Validator) context() context.Context {
+	if s.Ctx == nil {
+		return context.Background()
+	}
+	return s.Ctx
+}
+
+// newOrm: an orm whose calls are cancelled with the Ctx of the validator, or by the db timeout.
+func (s *Validator) newOrm() *orm.Orm {
+	return &orm.Orm{Db: s.Db, Ctx: s.Ctx, Timeout: config.Instance().DbTimeout()}
+}
+
 func (s *Validator) Run() (err error) {
 	if s.Db == nil {
 		err = errors.Errorf("db is nil, please check")
 		return
 	}
+	defer func() {
+		// The changes of the failed block may be left in memory only, load the state again next time.
+		if err != nil {
+			s.state = nil
+		}
+	}()
 
 	validatorDictKey := strings.ToLower(s.Chain) + ".ord.validator.block"
 
@@ -41,407 +65,231 @@ func (s *Validator) Run() (err error) {
 
 	log.Printf("found indexed block:%d validated block:%d", indexerBlock, validatorBlock)
 
+	genesisBlock := s.getGenesisBlock()
 	if validatorBlock <= 0 {
-		validatorBlock = s.getGenesisBlock()
+		validatorBlock = genesisBlock
 		if err = s.saveDict(validatorDictKey, validatorBlock); err != nil {
 			return
 		}
 	}
 	if validatorBlock < indexerBlock {
-		if err = s.loadTickData(); err != nil {
+		if err = s.startJournal(validatorBlock, genesisBlock); err != nil {
 			return
 		}
-		if err = s.loadAddressData(); err != nil {
-			return
+		if s.state == nil || s.state.block != validatorBlock {
+			if err = s.loadState(); err != nil {
+				return
+			}
 		}
 	}
 
 	for block := validatorBlock + 1; block <= indexerBlock; block++ {
-		if err = s.validateBlock(block); err != nil {
-			return
-		}
-		if err = s.updateDict(validatorDictKey, block); err != nil {
+		// The hash, the snapshot and the checkpoint are written in the transaction of the changes of the block.
+		if _, err = s.validateBlock(block, func(_orm *orm.Orm, result *engine.Result) (err error) {
+			if err = s.saveBlockHash(_orm, block, genesisBlock, result); err != nil {
+				return
+			}
+			if err = s.snapshotIfNeeded(_orm, block); err != nil {
+				return
+			}
+			return s.updateDict(_orm, validatorDictKey, block)
+		}); err != nil {
 			return
 		}
 	}
 	return
 }
 
-func (s *Validator) Revalidate(startBlock, endBlock int64, ticks []string) (err error) {
+// Revalidate recalculates the ticks from startBlock to endBlock in the shadow tables, the live tables are only replaced
+// in one transaction after the result passes the invariant check. If diffOnly is set, the live tables are kept and the
+// changes the revalidation would make are returned only.
+// The start defaults to the block before the earliest deploy of the ticks and the end to the validator checkpoint, which is
+// the only end allowed unless diffOnly is set.
+// The progress is saved after every block, an interrupted revalidation of the same ticks and start resumes from it.
+func (s *Validator) Revalidate(startBlock, endBlock int64, ticks []string, diffOnly bool) (changes []*Change, err error) {
+	return s.revalidate(startBlock, endBlock, ticks, diffOnly, nil)
+}
+
+// revalidate: the ticks are swapped along with the statements of the rollback to endBlock if any, otherwise endBlock must be
+// the validator checkpoint.
+func (s *Validator) revalidate(startBlock, endBlock int64, ticks []string, diffOnly bool, rollback []statement) (changes []*Change, err error) {
 	log.Printf("revalidating ticks:%s", conv.String(ticks))
 	if len(ticks) == 0 {
 		err = errors.Errorf("ticks not allowed empty")
 		return
 	}
+	// The live state of Run is restored afterwards, unless the swap replaces the tables under it.
+	state, validateTicks := s.state, s.validateTicks
+	defer func() {
+		s.state, s.validateTicks = state, validateTicks
+	}()
 	s.validateTicks = slice.Map(ticks, func(item string) string {
 		return strings.ToLower(item)
 	})
+	sort.Strings(s.validateTicks)
 
-	if err = s.loadTickData(); err != nil {
+	if err = s.repairDeployPosition(); err != nil {
 		return
 	}
-
-	if err = s.loadAddressData(); err != nil {
+	if startBlock, endBlock, err = s.detectRange(startBlock, endBlock, s.validateTicks); err != nil {
 		return
 	}
-
-	for _, tick := range s.validateTicks {
-		s.tickMap[tick].MintedAmount = "0"
-		s.tickMap[tick].BlockAtUpdate = 0
+	// The other ticks and the hashes of the blocks stay at the checkpoint, the swapped ticks must end there as well.
+	if validatorBlock := s.getDictValue(strings.ToLower(s.Chain) + ".ord.validator.block"); !diffOnly && rollback == nil && endBlock != validatorBlock {
+		err = errors.Errorf("end block:%d is not the validated block:%d, only the diff is allowed", endBlock, validatorBlock)
+		return
 	}
+	log.Printf("revalidating from block:%d to block:%d", startBlock+1, endBlock)
 
-	for _, addr := range s.addressMap {
-		if slice.Contains(s.validateTicks, strings.ToLower(addr.Tick)) {
-			// Reset the balance of the address, i.e., start calculating the balance from beginning.
-			addr.Available = ""
-			addr.Transferable = ""
-			addr.BlockAtUpdate = 0
-		}
+	var progress *revalidateProgress
+	if progress, err = s.loadProgress(startBlock, s.validateTicks); err != nil {
+		return
 	}
-	for block := startBlock + 1; block <= endBlock; block++ {
-		if err = s.validateBlock(block); err != nil {
+	if progress != nil {
+		log.Printf("resuming revalidation from block:%d", progress.Block+1)
+	} else {
+		// Reset the balance of the ticks in the shadow tables, i.e., start calculating the balance from beginning.
+		if err = s.createShadow(s.validateTicks); err != nil {
 			return
 		}
-	}
-	return
-}
-
-// loadTickData: load tick data from db for speedy validation
-func (s *Validator) loadTickData() (err error) {
-	log.Printf("loading all tick table data")
-	if s.tickMap == nil {
-		s.tickMap = make(map[string]*models.Tick)
-	}
-	_orm := &orm.Orm{Db: s.Db}
-	obj := &models.Tick{}
-	startId := int64(0)
-	limit := 2000
-	for {
-		log.Printf("load tick, start id:%d", startId)
-		if items, _err := _orm.Find((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(obj).WhereGT("Id", startId).Extra("order by id asc limit ?", limit)); _err != nil {
-			err = _err
+		progress = &revalidateProgress{Ticks: s.validateTicks, Start: startBlock, Block: startBlock}
+		if err = s.saveProgress(s.newOrm(), progress); err != nil {
 			return
-		} else {
-			var mutex sync.Mutex
-			if err = s.batchExec(items, func(_info any) (funcErr error) {
-				tick := _info.(*models.Tick)
-				var tx any
-				_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-				if tick.DeployTx != "" && tick.DeployPosition <= 0 {
-					if tx, funcErr = _orm.One(_m.Bind(&models.Tx{}).Where("TxId", tick.DeployTx), ""); funcErr != nil {
-						return
-					} else { // If tx is nil, an exception will be thrown. This helps us identify situations where a tick lacks a deploy transaction, although such cases are generally rare.
-						tick.DeployPosition = tx.(*models.Tx).Position
-						if _, err = _orm.Update(_m.Bind(tick).Update("DeployPosition", tick.DeployPosition).Where("Id", tick.Id)); err != nil {
-							return
-						}
-					}
-				}
-				mutex.Lock()
-				defer mutex.Unlock()
-				s.tickMap[strings.ToLower(tick.Name)] = tick
-				return
-			}); err != nil {
-				return
-			}
-			if len(items) < limit {
-				break
-			}
-			startId = items[len(items)-1].(*models.Tick).Id
 		}
 	}
-	return
-}
-
-// loadAddressData: load address data from db for speedy validation
-func (s *Validator) loadAddressData() (err error) {
-	log.Printf("loading all address balance table data")
-	if s.addressMap == nil {
-		s.addressMap = make(map[string]*models.Address)
-	}
-	_orm := &orm.Orm{Db: s.Db}
-	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-	obj := &models.Address{}
-	startId := int64(0)
-	limit := 2000
-	for {
-		if items, _err := _orm.Find(_m.Bind(obj).WhereGT("Id", startId).Extra("order by id asc limit ?", limit)); _err != nil {
-			err = _err
+	s.state = newDbState(s.Ctx, s.Chain, s.Db, shadowSuffix)
+	for _, tick := range s.validateTicks {
+		if _tick, _ := s.state.Tick(tick); _tick == nil {
+			err = errors.Errorf("tick:%s not found", tick)
 			return
-		} else {
-			for _, item := range items {
-				address := item.(*models.Address)
-				startId = address.Id
-				s.addressMap[strings.ToLower(fmt.Sprintf("%s,%s", address.Tick, address.Address))] = address
-			}
-			if len(items) < limit {
-				break
-			}
 		}
 	}
-	return
-}
-
-func (s *Validator) validateBlock(block int64) (err error) {
-	log.Printf("validating block:%d", block)
-	dirtyTick := make(map[string]bool)
-	dirtyAddress := make(map[string]bool)
-	var dirtyTransactions []any
-
-	// Because we batch update all transactions under a block, we need to cache these transactions.
-	// This ensures that 'transfer' transactions can obtain the correct 'inscribe-transfer' status before the database is updated.
-	txMap := make(map[string][]*models.Tx)
-
-	_orm := &orm.Orm{Db: s.Db}
-	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 
-	start := 0
-	limit := 2000
-	for {
-		if items, _err := _orm.Find(_m.Bind(&models.Tx{}).WhereGTE("BlockHeight", block).WhereLT("BlockHeight", block+1).Extra("order by pos asc,input_idx asc limit ?,?", start, limit)); _err != nil {
-			err = _err
+	// The progress is saved in the transaction of the changes of every block.
+	for block := progress.Block + 1; block <= endBlock; block++ {
+		if _, err = s.validateBlock(block, func(_orm *orm.Orm, result *engine.Result) error {
+			return s.saveProgress(_orm, &revalidateProgress{Ticks: progress.Ticks, Start: progress.Start, Block: block})
+		}); err != nil {
 			return
-		} else {
-			for _, item := range items {
-				tx := item.(*models.Tx)
-				if len(s.validateTicks) > 0 && !slice.Contains(s.validateTicks, strings.ToLower(tx.Tick)) {
-					continue
-				}
-				// No need for revalidation if it's a manual patch.
-				isPatch := strings.Index(tx.Reason, "patch:") == 0
-				if isPatch && tx.Status == models.TxStatusInvalid {
-					continue
-				}
-				tick := s.tickMap[strings.ToLower(tx.Tick)]
-				tx.Reason = ""
-				if tick == nil {
-					tx.Reason = fmt.Sprintf("The tick:%s has not been deployed yet.", tx.Tick)
-				} else {
-					senderKey := strings.ToLower(fmt.Sprintf("%s,%s", tx.Tick, tx.From))
-					recipientKey := strings.ToLower(fmt.Sprintf("%s,%s", tx.Tick, tx.To))
-					// ensure address has balance records
-					if tx.From != "" && s.addressMap[senderKey] == nil {
-						s.addressMap[senderKey] = &models.Address{
-							Tick:    tick.Name,
-							Address: tx.From,
-						}
-					}
-					if tx.To != "" && s.addressMap[recipientKey] == nil {
-						s.addressMap[recipientKey] = &models.Address{
-							Tick:    tick.Name,
-							Address: tx.To,
-						}
-					}
-					if tx.Reason = s.validateCommon(tx); tx.Reason == "" {
-						amount := conv.Decimal(tx.Amount)
-						switch strings.ToLower(tx.Operation) {
-						case "deploy": // No need to validate name, dec, max, lim; it seems redundant, so ignore them.
-							if tick.DeployTx != tx.TxId {
-								tx.Reason = fmt.Sprintf("The tick:%s has been deployed at %s.", tx.Tick, tick.DeployTx)
-							}
-						case "mint":
-							if tx.Reason = s.validateMint(tx, tick); isPatch || tx.Reason == "" {
-								remainMintAmount := conv.Decimal(tick.Supply).Sub(conv.Decimal(tick.MintedAmount))
-								if remainMintAmount.LessThanOrEqual(amount) { // remain mint amount <= tx amount
-									if tick.BlockAtUpdate < block {
-										tx.ValidAmount = remainMintAmount.String()
-										tick.MintedAmount = tick.Supply
-										tick.FinishMintTx = tx.TxId
-										tick.FinishMintTime = tx.BlockTime
-										dirtyTick[strings.ToLower(tick.Name)] = true
-									}
-
-									if s.addressMap[recipientKey].BlockAtUpdate < block {
-										s.addressMap[recipientKey].Available = conv.Decimal(s.addressMap[recipientKey].Available).Add(remainMintAmount).String()
-										dirtyAddress[recipientKey] = true
-									}
-								} else { // remain mint amount is sufficient
-									if tick.BlockAtUpdate < block {
-										tick.MintedAmount = conv.Decimal(tick.MintedAmount).Add(amount).String()
-										dirtyTick[strings.ToLower(tick.Name)] = true
-									}
-
-									if s.addressMap[recipientKey].BlockAtUpdate < block {
-										s.addressMap[recipientKey].Available = conv.Decimal(s.addressMap[recipientKey].Available).Add(amount).String()
-										dirtyAddress[recipientKey] = true
-									}
-								}
-							}
-						case "inscribe-transfer":
-							if tx.Reason = s.validateInscribeTransfer(tx, recipientKey); isPatch || tx.Reason == "" {
-								if s.addressMap[recipientKey].BlockAtUpdate < block {
-									s.addressMap[recipientKey].Available = conv.Decimal(s.addressMap[recipientKey].Available).Sub(amount).String()
-									s.addressMap[recipientKey].Transferable = conv.Decimal(s.addressMap[recipientKey].Transferable).Add(amount).String()
-									dirtyAddress[recipientKey] = true
-								}
-							}
-						case "transfer":
-							if tx.Reason, err = s.validateTransfer(tx, senderKey, txMap); err != nil {
-								return
-							} else if isPatch || tx.Reason == "" {
-								// Do not revalidate addresses that have been verified before to avoid discrepancies caused by duplicate changes in amounts.
-								// Validation must occur incrementally for each block; it cannot be done intermittently.
-								// Otherwise, transactions that were verified later may be invalid, requiring revalidation.
-								if s.addressMap[senderKey].BlockAtUpdate < block {
-									// Deduct transferable-amount from the sender.
-									s.addressMap[senderKey].Transferable = conv.Decimal(s.addressMap[senderKey].Transferable).Sub(amount).String()
-									dirtyAddress[senderKey] = true
-								}
-								if s.addressMap[senderKey].BlockAtUpdate < block {
-									// Credit available-amount to the recipient.
-									s.addressMap[recipientKey].Available = conv.Decimal(s.addressMap[recipientKey].Available).Add(amount).String()
-									dirtyAddress[recipientKey] = true
-								}
-							}
-						default:
-							tx.Reason = fmt.Sprintf("unknown op:%s", tx.Operation)
-						}
-					}
-				}
-				if tx.Reason != "" {
-					tx.Status = models.TxStatusInvalid
-				} else {
-					tx.Status = models.TxStatusValid
-				}
-
-				if !isPatch {
-					dirtyTransactions = append(dirtyTransactions, tx)
-				}
-				txMap[tx.TxId] = append(txMap[tx.TxId], tx)
-			}
-			start += limit
-			if len(items) < limit {
-				break
-			}
 		}
+		progress.Block = block
 	}
 
-	log.Printf("updating %d tx", len(dirtyTransactions))
-	// use goroutine to boost speedy update
-	if err = s.batchExec(dirtyTransactions, func(_info any) (funcErr error) {
-		info := _info.(*models.Tx)
-		_model := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-		_, funcErr = _orm.Update(_model.Bind(&models.Tx{}).Update("Status", info.Status).Update("Reason", info.Reason).Update("ValidAmount", info.ValidAmount).Where("Id", info.Id))
+	var violations []*engine.Violation
+	if violations, err = s.check(s.state, s.validateTicks); err != nil {
 		return
-	}); err != nil {
+	} else if len(violations) > 0 {
+		for _, violation := range violations {
+			log.Printf("[ERROR] invariant broken, %s", violation)
+		}
+		// Resuming would end up with the same shadow tables, start over next time.
+		if err = s.deleteProgress(); err != nil {
+			return
+		}
+		err = errors.Errorf("%d invariants broken in the shadow tables, the live tables are kept", len(violations))
 		return
 	}
-
-	log.Printf("updating %d tick", len(dirtyTick))
-	var ticks []any
-	for key := range dirtyTick {
-		ticks = append(ticks, s.tickMap[key])
-	}
-	if err = s.batchExec(ticks, func(_info any) (funcErr error) {
-		info := _info.(*models.Tick)
-		_model := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-		if info.BlockAtUpdate < block {
-			info.BlockAtUpdate = block
-		}
-		_, funcErr = _orm.Update(_model.Bind(&models.Tick{}).Update("MintedAmount", info.MintedAmount).Update("FinishMintTx", info.FinishMintTx).Update("FinishMintTime", info.FinishMintTime).Update("BlockAtUpdate", info.BlockAtUpdate).Where("Id", info.Id))
+	if changes, err = s.diffShadow(); err != nil {
 		return
-	}); err != nil {
+	}
+	log.Printf("revalidation changes %d rows", len(changes))
+	if diffOnly {
+		err = s.dropShadow()
+	} else {
+		state = nil
+		err = s.swapShadow(startBlock, endBlock, s.validateTicks, rollback)
+	}
+	if err != nil {
 		return
 	}
+	err = s.deleteProgress()
+	return
+}
 
-	log.Printf("updating %d address", len(dirtyAddress))
-	var addresses []any
-	for key := range dirtyAddress {
-		addresses = append(addresses, s.addressMap[key])
+func (s *Validator) loadState() (err error) {
+	if err = s.repairDeployPosition(); err != nil {
+		return
 	}
-	if err = s.batchExec(addresses, func(_info any) (funcErr error) {
-		info := _info.(*models.Address)
-		_model := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-		_obj := &models.Address{}
-		if info.BlockAtUpdate < block {
-			info.BlockAtUpdate = block
+	s.state = newDbState(s.Ctx, s.Chain, s.Db, "")
+	return
+}
+
+// repairDeployPosition: fill the deploy position of ticks indexed before the position was recorded.
+func (s *Validator) repairDeployPosition() (err error) {
+	_orm := s.newOrm()
+	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+	var repaired []any
+	if err = _orm.EachPage(_m.Bind(&models.Tick{}), 2000, func(item any) (funcErr error) {
+		tick := item.(*models.Tick)
+		if tick.DeployTx == "" || tick.DeployPosition > 0 {
+			return
 		}
-		if info.Id <= 0 {
-			var addressId int64
-			if _, addressId, funcErr = _orm.Save(_model.Bind(_obj).BatchData(info)); err != nil {
-				return
-			} else if addressId > 0 {
-				info.Id = addressId
-			}
-		} else {
-			_, funcErr = _orm.Update(_model.Bind(_obj).Update("Available", info.Available).Update("Transferable", info.Transferable).Update("BlockAtUpdate", info.BlockAtUpdate).Where("Id", info.Id))
+		var tx *models.Tx
+		_model := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
+		if tx, funcErr = orm.First[*models.Tx](_orm, _model.Bind(&models.Tx{}).Where("TxId", tick.DeployTx)); funcErr != nil {
+			return
 		}
+		// If tx is nil, an exception will be thrown. This helps us identify situations where a tick lacks a deploy transaction, although such cases are generally rare.
+		tick.DeployPosition = tx.Position
+		repaired = append(repaired, tick)
 		return
 	}); err != nil {
 		return
 	}
+	err = _orm.BulkUpdate(_m.Bind(&models.Tick{}).BatchData(repaired...).Overwrite("DeployPosition"), 500, false)
 	return
 }
 
-func (s *Validator) validateCommon(tx *models.Tx) string {
-	if tx.From == "" && tx.To == "" {
-		return "'from' and 'to' address are both empty"
+// validateBlock: validate the txs of the block and write the changes back, the invariants are checked before writing if needed.
+// What save writes through the orm is committed in one transaction with the changes.
+func (s *Validator) validateBlock(block int64, save func(_orm *orm.Orm, result *engine.Result) error) (result *engine.Result, err error) {
+	log.Printf("validating block:%d", block)
+	var txs []*models.Tx
+	if txs, err = s.loadBlockTxs(block); err != nil {
+		return
 	}
-
-	if !strings.EqualFold(tx.Operation, "transfer") {
-		protocolName := config.Instance().OrdProtocolName[strings.ToLower(s.Chain)]
-		if m := conv.Map(tx.Content); m != nil && !strings.EqualFold(conv.String(m["p"]), protocolName) {
-			return "not " + protocolName + " protocol"
-		}
-		contentType := strings.ToLower(strings.TrimSpace(tx.Meta))
-		if strings.Index(contentType, "text/plain") != 0 && strings.Index(contentType, "application/json") != 0 {
-			return fmt.Sprintf("content-type:%s is not valid", tx.Meta)
-		}
+	if err = s.state.prefetch(txs); err != nil {
+		return
 	}
-
-	if !strings.EqualFold(tx.Operation, "deploy") && conv.Decimal(tx.Amount).LessThanOrEqual(decimal.Zero) {
-		return fmt.Sprintf("The amount:%s not valid", tx.Amount)
+	_engine := &engine.Engine{Protocol: config.Instance().OrdProtocolName[strings.ToLower(s.Chain)], State: s.state, Workers: s.Workers}
+	if result, err = _engine.ApplyBlock(block, txs); err != nil {
+		return
 	}
-	return ""
-}
-
-func (s *Validator) validateMint(tx *models.Tx, tick *models.Tick) string {
-	amount := conv.Decimal(tx.Amount)
-	if tick.DeployTime > tx.BlockTime || (tick.DeployTime == tx.BlockTime && tick.DeployPosition > tx.Position) {
-		return fmt.Sprintf("The tick:%s has not been deployed before %d.", tx.Tick, tx.BlockTime)
-	} else if amount.GreaterThan(conv.Decimal(tick.MintLimit)) {
-		return fmt.Sprintf("The mint amount:%s has exceeded mint limit:%s", tx.Amount, tick.MintLimit)
-	} else {
-		remainMintAmount := conv.Decimal(tick.Supply).Sub(conv.Decimal(tick.MintedAmount))
-		if remainMintAmount.LessThanOrEqual(decimal.Zero) { // remain mint amount is zero
-			return fmt.Sprintf("The tick:%s have already been full minted.", tick.Name)
+	if s.CheckInvariants {
+		if violations := result.Check(); len(violations) > 0 {
+			for _, violation := range violations {
+				log.Printf("[ERROR] invariant broken, %s", violation)
+			}
+			err = errors.WithStack(&engine.InvariantError{Block: block, Violations: violations})
+			return
 		}
 	}
-	return ""
-}
-
-func (s *Validator) validateInscribeTransfer(tx *models.Tx, addressKey string) string {
-	amount := conv.Decimal(tx.Amount)
-	if conv.Decimal(s.addressMap[addressKey].Available).LessThan(amount) {
-		return fmt.Sprintf("Insufficient balance for inscription; 'available balance' is only '%s'", s.addressMap[addressKey].Available)
-	}
-	return ""
+	err = s.state.commit(result, func(_orm *orm.Orm) error {
+		return save(_orm, result)
+	})
+	return
 }
 
-func (s *Validator) validateTransfer(tx *models.Tx, addressKey string, txMap map[string][]*models.Tx) (reason string, err error) {
-	amount := conv.Decimal(tx.Amount)
-	_orm := &orm.Orm{Db: s.Db}
+// loadBlockTxs: load the txs of the block ordered by position, only the txs of the ticks being revalidated if any.
+// The results of the patched txs are forced by their patches.
+func (s *Validator) loadBlockTxs(block int64) (txs []*models.Tx, err error) {
+	_orm := s.newOrm()
 	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
-
-	if conv.Decimal(s.addressMap[addressKey].Transferable).LessThan(amount) {
-		reason = fmt.Sprintf("Insufficient balance for inscription; 'transferable balance' is only '%s'", s.addressMap[addressKey].Transferable)
-	} else {
-		inscribeTx := tx.InscriptionId[0:64]
-		if len(txMap[inscribeTx]) > 0 && txMap[inscribeTx][0].Status == models.TxStatusValid {
-			return
-		}
-		if inscribeTx, _err := _orm.One(_m.Bind(&models.Tx{}).Where("TxId", inscribeTx).Where("Operation", "inscribe-transfer").Where("Tick", tx.Tick).Where("Status", 1), ""); _err != nil {
-			err = _err
-			return
-		} else if inscribeTx == nil {
-			reason = fmt.Sprintf("The previous inscribe-transfer tx:%s failed.", tx.InscriptionId)
+	if err = _orm.Each(_m.Bind(&models.Tx{}).WhereGTE("BlockHeight", block).WhereLT("BlockHeight", block+1).OrderBy("Position").OrderBy("InputIndex"), func(item any) error {
+		tx := item.(*models.Tx)
+		if len(s.validateTicks) == 0 || slice.Contains(s.validateTicks, strings.ToLower(tx.Tick)) {
+			txs = append(txs, tx)
 		}
+		return nil
+	}); err != nil {
+		return
 	}
+	err = s.applyPatches(block, txs)
 	return
 }
 
 func (s *Validator) getDictValue(key string) int64 {
-	_orm := &orm.Orm{Db: s.Db}
+	_orm := s.newOrm()
 	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 	obj := &models.Dict{}
 	if str, _err := _orm.One(_m.Bind(obj).Where("Key", key), "value"); _err != nil {
@@ -452,8 +300,7 @@ func (s *Validator) getDictValue(key string) int64 {
 	return 0
 }
 
-func (s *Validator) updateDict(key string, value any) error {
-	_orm := &orm.Orm{Db: s.Db}
+func (s *Validator) updateDict(_orm *orm.Orm, key string, value any) error {
 	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 	obj := &models.Dict{}
 	_, err := _orm.Update(_m.Bind(obj).Update("Value", value).Where("Key", key))
@@ -461,7 +308,7 @@ func (s *Validator) updateDict(key string, value any) error {
 }
 
 func (s *Validator) saveDict(key string, value any) error {
-	_orm := &orm.Orm{Db: s.Db}
+	_orm := s.newOrm()
 	_m := &orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}
 	obj := &models.Dict{Key: key, Value: conv.String(value)}
 	_, _, err := _orm.Save(_m.Bind(obj).BatchData(obj))
@@ -469,39 +316,10 @@ func (s *Validator) saveDict(key string, value any) error {
 }
 
 func (s *Validator) getGenesisBlock() int64 {
-	if tx, _err := (&orm.Orm{Db: s.Db}).One((&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(&models.Tx{}).Extra("order by block_height asc limit 1"), ""); _err != nil {
+	if tx, _err := orm.First[*models.Tx](s.newOrm(), (&orm.Model{TablePrefix: strings.ToLower(s.Chain) + "_"}).Bind(&models.Tx{}).OrderBy("BlockHeight").Limit(1)); _err != nil {
 		log.Fatalf("get db error:%+v", _err)
 	} else if tx != nil {
-		return tx.(*models.Tx).BlockHeight - 1
+		return tx.BlockHeight - 1
 	}
 	return 0
 }
-
-func (s *Validator) batchExec(items []any, callback func(_info any) error) (err error) {
-	for parti := range slice.Partition(len(items), 20) {
-		partiItems := items[parti.Low:parti.High]
-		var wg sync.WaitGroup
-		errCh := make(chan error, len(partiItems))
-		for _, item := range partiItems {
-			wg.Add(1)
-			go func(info any) {
-				defer wg.Done()
-				if info == nil {
-					return
-				}
-				if _err := callback(info); _err != nil {
-					errCh <- _err
-					return
-				}
-			}(item)
-		}
-		go func() {
-			wg.Wait()
-			close(errCh)
-		}()
-		if err = <-errCh; err != nil {
-			return
-		}
-	}
-	return
-}
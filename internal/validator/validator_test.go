@@ -0,0 +1,239 @@
+package validator
+
+import (
+	"database/sql"
+	"fmt"
+	"libord/config"
+	"libord/internal/migrate"
+	"libord/internal/models"
+	"libord/pkg/orm"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// newTestValidator: a validator of btc on a migrated sqlite database, with the txs of blocks 100 to 103 indexed:
+// ordi and sats are deployed at 100, minted at 101 and 102, and 100 ordi of bc1qa are transferred to bc1qc at 103.
+func newTestValidator(t *testing.T) *Validator {
+	_db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	_db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_db.Close()
+	})
+	_, err = (&migrate.Migrator{Chain: "btc", Db: _db}).Up()
+	assert.Nil(t, err)
+	config.Instance().OrdProtocolName = map[string]string{"btc": "brc-20"}
+
+	_orm := &orm.Orm{Db: _db}
+	newModel := func() *orm.Model {
+		return &orm.Model{TablePrefix: "btc_"}
+	}
+	newTx := func(txid, op, tick, from, to, amount string, block int64, pos int) *models.Tx {
+		return &models.Tx{TxId: txid, InscriptionId: txid + "i0", Operation: op, Tick: tick, Amount: amount, From: from, To: to,
+			BlockHeight: block, BlockTime: 1690000000 + block, Position: pos, Meta: "text/plain;charset=utf-8",
+			Content: fmt.Sprintf(`{"p":"brc-20","op":"%s","tick":"%s","amt":"%s"}`, op, tick, amount)}
+	}
+	var txs []any
+	for i, tick := range []string{"ordi", "sats"} {
+		deployTx := fmt.Sprintf("%064d", i+1)
+		_, _, err = _orm.Save(newModel().Bind(&models.Tick{}).BatchData(&models.Tick{Name: tick, Supply: "1000", MintLimit: "600", MintedAmount: "0",
+			DeployTx: deployTx, DeployPosition: i, DeployAddress: "bc1qd", DeployTime: 1690000100}))
+		assert.Nil(t, err)
+		txs = append(txs,
+			newTx(deployTx, "deploy", tick, "", "bc1qd", "", 100, i),
+			newTx(fmt.Sprintf("%s%060d", tick, 1), "mint", tick, "", "bc1qa", "400", 101, i*2),
+			newTx(fmt.Sprintf("%s%060d", tick, 2), "mint", tick, "", "bc1qb", "400", 101, i*2+1),
+			newTx(fmt.Sprintf("%s%060d", tick, 3), "inscribe-transfer", tick, "", "bc1qa", "100", 102, i*2),
+			newTx(fmt.Sprintf("%s%060d", tick, 4), "mint", tick, "", "bc1qa", "400", 102, i*2+1))
+		transfer := newTx(fmt.Sprintf("%s%060d", tick, 5), "transfer", tick, "bc1qa", "bc1qc", "100", 103, i)
+		transfer.InscriptionId = fmt.Sprintf("%s%060d", tick, 3) + "i0"
+		txs = append(txs, transfer)
+	}
+	_, _, err = _orm.Save(newModel().Bind(&models.Tx{}).BatchData(txs...))
+	assert.Nil(t, err)
+	_, _, err = _orm.Save(newModel().Bind(&models.Dict{}).BatchData(&models.Dict{Key: "btc.ord.indexer.block", Value: "103"}))
+	assert.Nil(t, err)
+	return &Validator{Chain: "btc", Db: _db}
+}
+
+// balances: the available and transferable balances of the tick by address, "" is taken as 0.
+func balances(t *testing.T, s *Validator, tick string) map[string]string {
+	items, err := orm.Find[*models.Address](s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Address{}).Where("Tick", tick))
+	assert.Nil(t, err)
+	ret := make(map[string]string)
+	for _, item := range items {
+		ret[item.Address] = balanceOf(item)
+	}
+	return ret
+}
+
+func Test_ValidatorRun(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	assert.Equal(t, int64(103), s.getDictValue("btc.ord.validator.block"))
+	assert.Equal(t, map[string]string{"bc1qa": "500,0", "bc1qb": "400,0", "bc1qc": "100,0"}, balances(t, s, "ordi"))
+	violations, err := s.Check(nil)
+	assert.Nil(t, err)
+	assert.Len(t, violations, 0)
+}
+
+func Test_Revalidate(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected := balances(t, s, "ordi")
+	_, err := s.Db.Exec("update btc_ord_address set available='999' where tick='ordi' and address='bc1qa'")
+	assert.Nil(t, err)
+	_, err = s.Db.Exec("update btc_ord_address set available='999' where tick='sats' and address='bc1qa'")
+	assert.Nil(t, err)
+
+	// The diff keeps the live tables.
+	changes, err := s.Revalidate(0, 0, []string{"ORDI"}, true)
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "address", changes[0].Table)
+	assert.Equal(t, "999,0", balances(t, s, "ordi")["bc1qa"])
+
+	changes, err = s.Revalidate(0, 0, []string{"ordi"}, false)
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+	// The other ticks are kept as they are.
+	assert.Equal(t, "999,0", balances(t, s, "sats")["bc1qa"])
+	items, err := orm.Find[*models.BalanceEvent](s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.BalanceEvent{}).Where("Tick", "ordi"))
+	assert.Nil(t, err)
+	assert.Len(t, items, 6)
+	count, err := orm.Count(s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Address{}).Table("ord_address_shadow"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func Test_RevalidateHashes(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	// The transfer is sent to another address after it was validated, e.g: the indexer fixed a bug.
+	_, err := s.Db.Exec("update btc_ord_tx set `to`='bc1qe' where op='transfer' and tick='ordi'")
+	assert.Nil(t, err)
+
+	_, err = s.Revalidate(0, 102, []string{"ordi"}, false)
+	assert.NotNil(t, err)
+	_, err = s.Revalidate(0, 0, []string{"ordi"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "100,0", balances(t, s, "ordi")["bc1qe"])
+
+	// The chain is the one validated from scratch with the fixed tx.
+	expected := newTestValidator(t)
+	_, err = expected.Db.Exec("update btc_ord_tx set `to`='bc1qe' where op='transfer' and tick='ordi'")
+	assert.Nil(t, err)
+	assert.Nil(t, expected.Run())
+	hashes := blockHashes(t, s)
+	assert.Equal(t, blockHashes(t, expected), hashes)
+	assert.Equal(t, "", hashes[100].PrevHash)
+	for block := int64(101); block <= 103; block++ {
+		assert.Equal(t, hashes[block-1].Hash, hashes[block].PrevHash)
+	}
+}
+
+func Test_Patch(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected := balances(t, s, "ordi")
+	transferTx := fmt.Sprintf("ordi%060d", 5)
+	txOf := func() *models.Tx {
+		tx, err := orm.First[*models.Tx](s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tx{}).Where("TxId", transferTx))
+		assert.Nil(t, err)
+		return tx
+	}
+
+	assert.Nil(t, s.AddPatch(&models.Patch{TxId: transferTx, Status: models.TxStatusInvalid, Reason: "wrong", Author: "tester"}))
+	// The patch of the tx is replaced.
+	assert.Nil(t, s.AddPatch(&models.Patch{TxId: transferTx, Status: models.TxStatusInvalid, Reason: "stolen", Author: "tester"}))
+	patches, err := s.Patches("ordi")
+	assert.Nil(t, err)
+	assert.Len(t, patches, 1)
+	assert.Equal(t, "stolen", patches[0].Reason)
+	assert.Equal(t, map[string]string{"bc1qa": "500,100", "bc1qb": "400,0", "bc1qc": "0,0"}, balances(t, s, "ordi"))
+	assert.Equal(t, models.TxStatusInvalid, txOf().Status)
+	assert.Equal(t, "patch:stolen", txOf().Reason)
+
+	assert.Nil(t, s.RemovePatch(transferTx, "", 0))
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+	assert.Equal(t, models.TxStatusValid, txOf().Status)
+	assert.Equal(t, "", txOf().Reason)
+}
+
+func Test_Rollback(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected, hashes := balances(t, s, "ordi"), blockHashes(t, s)
+
+	assert.Nil(t, s.Rollback(101, false))
+	assert.Equal(t, int64(101), s.getDictValue("btc.ord.validator.block"))
+	assert.Equal(t, map[string]string{"bc1qa": "400,0", "bc1qb": "400,0", "bc1qc": "0,0"}, balances(t, s, "ordi"))
+	tick, err := orm.First[*models.Tick](s.newOrm(), (&orm.Model{TablePrefix: "btc_"}).Bind(&models.Tick{}).Where("Name", "ordi"))
+	assert.Nil(t, err)
+	assert.Equal(t, "800", tick.MintedAmount)
+	assert.Equal(t, "", tick.FinishMintTx)
+	assert.Len(t, blockHashes(t, s), 2)
+
+	// The blocks are validated again to the same state.
+	assert.Nil(t, s.Run())
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+	assert.Equal(t, hashes, blockHashes(t, s))
+
+	// The balances of the ticks deployed after the block are dropped.
+	assert.Nil(t, s.Rollback(99, false))
+	assert.Len(t, balances(t, s, "ordi"), 0)
+}
+
+func Test_RollbackBeforeJournal(t *testing.T) {
+	interval := config.Instance().SnapshotInterval
+	config.Instance().SnapshotInterval = map[string]int64{"btc": 2}
+	defer func() {
+		config.Instance().SnapshotInterval = interval
+	}()
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected := balances(t, s, "ordi")
+	// The journal is kept from block 102, the snapshots are taken at 100 and 102.
+	_, err := s.Db.Exec("delete from btc_ord_balance_event where block<102")
+	assert.Nil(t, err)
+
+	ok, err := s.journalCovers(102, "ordi")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.NotNil(t, s.Rollback(101, false))
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+
+	assert.Nil(t, s.Rollback(102, false))
+	assert.Equal(t, map[string]string{"bc1qa": "500,100", "bc1qb": "400,0", "bc1qc": "0,0"}, balances(t, s, "ordi"))
+	assert.Nil(t, s.Rollback(101, true))
+	assert.Equal(t, map[string]string{"bc1qa": "400,0", "bc1qb": "400,0", "bc1qc": "0,0"}, balances(t, s, "ordi"))
+}
+
+func Test_RollbackRevalidateInterrupted(t *testing.T) {
+	s := newTestValidator(t)
+	assert.Nil(t, s.Run())
+	expected, hashes := balances(t, s, "ordi"), blockHashes(t, s)
+
+	// The revalidation fails before the swap, nothing of the rollback is written.
+	_, err := s.Db.Exec("alter table btc_ord_balance_event_shadow rename to btc_ord_balance_event_moved")
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Rollback(101, true))
+	assert.Equal(t, int64(103), s.getDictValue("btc.ord.validator.block"))
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+	assert.Equal(t, hashes, blockHashes(t, s))
+
+	// It's run again to the end.
+	_, err = s.Db.Exec("alter table btc_ord_balance_event_moved rename to btc_ord_balance_event_shadow")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Rollback(101, true))
+	assert.Equal(t, int64(101), s.getDictValue("btc.ord.validator.block"))
+	assert.Equal(t, map[string]string{"bc1qa": "400,0", "bc1qb": "400,0", "bc1qc": "0,0"}, balances(t, s, "ordi"))
+	assert.Len(t, blockHashes(t, s), 2)
+	assert.Nil(t, s.Run())
+	assert.Equal(t, expected, balances(t, s, "ordi"))
+	assert.Equal(t, hashes, blockHashes(t, s))
+}
@@ -27,9 +27,14 @@ type Request struct {
 }
 
 func (r *Request) DoReq() (respBytes []byte, httpStatusCode int, errRet error) {
+	return r.DoReqContext(context.Background())
+}
+
+// DoReqContext sends the request as DoReq, it's cancelled with ctx, or after ReadTimeOut.
+func (r *Request) DoReqContext(ctx context.Context) (respBytes []byte, httpStatusCode int, errRet error) {
 	r.EnsureDefaults()
 
-	ctx, cancel := context.WithTimeout(context.Background(), r.ReadTimeOut)
+	ctx, cancel := context.WithTimeout(ctx, r.ReadTimeOut)
 	defer cancel()
 
 	var reader io.Reader
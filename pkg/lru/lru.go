@@ -0,0 +1,71 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a thread safe cache holding at most Capacity items, the least recently used item is evicted first.
+type Cache[K comparable, V any] struct {
+	capacity int
+	ll       *list.List
+	items    map[K]*list.Element
+	sync.Mutex
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates a cache, capacity <= 0 means unbounded.
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value of the key and marks it as the most recently used.
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	if e, found := c.items[key]; found {
+		c.ll.MoveToFront(e)
+		return e.Value.(*entry[K, V]).value, true
+	}
+	return
+}
+
+// Add sets the value of the key as the most recently used, and evicts the least recently used items over the capacity.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.Lock()
+	defer c.Unlock()
+	if e, found := c.items[key]; found {
+		c.ll.MoveToFront(e)
+		e.Value.(*entry[K, V]).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value})
+	for c.capacity > 0 && c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+func (c *Cache[K, V]) Remove(key K) {
+	c.Lock()
+	defer c.Unlock()
+	if e, found := c.items[key]; found {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,37 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cache(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	// b is the least recently used one.
+	c.Add("c", 3)
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	c.Add("a", 10)
+	v, _ = c.Get("a")
+	assert.Equal(t, 10, v)
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	unbounded := New[int, int](0)
+	for i := 0; i < 100; i++ {
+		unbounded.Add(i, i)
+	}
+	assert.Equal(t, 100, unbounded.Len())
+}
@@ -0,0 +1,177 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Break stops Each and EachPage without an error when it's returned by the callback.
+var Break = errors.New("orm: break")
+
+// rowReader scans the rows of a query, the columns and their types are read once for all the rows.
+type rowReader struct {
+	columns []string
+	refs    []any // *sql.NullInt64 of the integer columns, *sql.NullString of the others
+}
+
+func newRowReader(rows *sql.Rows) (r *rowReader, err error) {
+	var columnTypes []*sql.ColumnType
+	if columnTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+	r = &rowReader{}
+	for _, columnType := range columnTypes {
+		r.columns = append(r.columns, columnType.Name())
+		if isIntColumn(columnType) {
+			r.refs = append(r.refs, &sql.NullInt64{})
+		} else {
+			r.refs = append(r.refs, &sql.NullString{})
+		}
+	}
+	return
+}
+
+// isIntColumn: the decimals are kept as strings, so are the floats, e.g: the amounts, to keep their precision.
+func isIntColumn(columnType *sql.ColumnType) bool {
+	if t := columnType.ScanType(); t != nil {
+		switch t {
+		case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}), reflect.TypeOf(sql.NullInt16{}):
+			return true
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return true
+		}
+	}
+	name := strings.ToUpper(columnType.DatabaseTypeName())
+	return strings.Contains(name, "INT") && !strings.Contains(name, "POINT")
+}
+
+// read scans the current row into a map of int64 or string values, nil for NULL.
+func (r *rowReader) read(rows *sql.Rows) (item map[string]any, err error) {
+	if err = rows.Scan(r.refs...); err != nil {
+		return
+	}
+	item = make(map[string]any, len(r.columns))
+	for i, column := range r.columns {
+		switch ref := r.refs[i].(type) {
+		case *sql.NullInt64:
+			if ref.Valid {
+				item[column] = ref.Int64
+			} else {
+				item[column] = nil
+			}
+		case *sql.NullString:
+			if ref.Valid {
+				item[column] = ref.String
+			} else {
+				item[column] = nil
+			}
+		}
+	}
+	return
+}
+
+// Each streams the rows of the query to fn one by one without keeping them, as the bound struct or as a map.
+// The integer columns are int64 in the map and the others are strings. It stops at the first error of fn, or at Break.
+// The rows are read while fn is called, so the Timeout of the orm covers the time of fn on all the rows too; EachPage
+// times the query of every page alone.
+func (o *Orm) Each(m *Model, fn func(item any) error) (errRet error) {
+	defer m.clean()
+	ctx, cancel := o.context()
+	defer cancel()
+	rows, err := o.conn().QueryContext(ctx, o.sqlModel(m).buildSelectSQL(), m.getArgs()...)
+	if err != nil {
+		errRet = err
+		return
+	}
+	defer rows.Close()
+
+	var r *rowReader
+	if r, errRet = newRowReader(rows); errRet != nil {
+		return
+	}
+	for rows.Next() {
+		var item map[string]any
+		if item, errRet = r.read(rows); errRet != nil {
+			return
+		}
+		if errRet = fn(m.convert(item)); errRet != nil {
+			if errRet == Break {
+				errRet = nil
+			}
+			return
+		}
+	}
+	errRet = rows.Err()
+	return
+}
+
+// EachPage passes the rows to fn in the order of the primary key as Each does, by keyset pagination: the rows are queried in pages
+// of size rows, each after the last key of the previous page. A page is read before fn is called on its rows, so that no cursor
+// stays open on the table and fn may write to the database. The primary key must be a single integer column, e.g: id, the order
+// and the limit of m are replaced, m must not have an offset, and its Extra must not order or limit them.
+func (o *Orm) EachPage(m *Model, size int, fn func(item any) error) (errRet error) {
+	defer m.clean()
+	if size <= 0 {
+		size = 2000
+	}
+	pk := m.pkColumns()
+	if len(pk) != 1 {
+		errRet = errors.New("orm: EachPage needs a primary key of a single column")
+		return
+	}
+	if m.offset != 0 { // it would skip the rows of every page
+		errRet = errors.New("orm: EachPage doesn't take an offset")
+		return
+	}
+	base := *m
+	lastId := int64(0)
+	for {
+		page := base
+		page.whereConditions = append([]string{}, base.whereConditions...)
+		page.whereArgs = append([]any{}, base.whereArgs...)
+		page.WhereGT(pk[0], lastId)
+		page.orderBy = nil
+		page.OrderBy(pk[0]).Limit(int64(size))
+
+		var items []any
+		if errRet = o.Each(&page, func(item any) error {
+			items = append(items, item)
+			return nil
+		}); errRet != nil {
+			return
+		}
+		for _, item := range items {
+			var ok bool
+			if lastId, ok = intKey(m.getItemMap(item)[pk[0]]); !ok {
+				errRet = fmt.Errorf("orm: EachPage needs an integer primary key, %s is %T", pk[0], m.getItemMap(item)[pk[0]])
+				return
+			}
+			if errRet = fn(item); errRet != nil {
+				if errRet == Break {
+					errRet = nil
+				}
+				return
+			}
+		}
+		if len(items) < size {
+			return
+		}
+	}
+}
+
+// intKey: the value of an integer key, the integer columns of a map are int64 and those of a struct are of any integer type.
+func intKey(v any) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return rv.Int(), true
+	case rv.CanUint():
+		return int64(rv.Uint()), true
+	}
+	return 0, false
+}
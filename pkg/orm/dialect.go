@@ -0,0 +1,258 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Dialect is the SQL flavor of a database. The statements are built in MySQL flavor, i.e., "`" quoting and "?"
+// placeholders, and rewritten by Rebind before they are sent, so that the raw SQL in Extra works with every dialect.
+type Dialect interface {
+	Name() string
+	// Rebind rewrites the quoting and placeholders of the MySQL flavored query.
+	Rebind(query string) string
+	// InsertIgnore inserts the rows and skips those conflicting with a unique key.
+	InsertIgnore(table string, columns []string, values string) string
+	// Upsert inserts the rows, the update columns of those conflicting with the keys are overwritten.
+	// The id column, if not empty, of the inserted or overwritten row is returned by LastInsertId or Returning.
+	Upsert(table string, columns []string, values string, keys, updates []string, id string) string
+	// UpdateValues updates the update columns of the rows matching the keys, by the values of rows rows of the keys and
+	// then the update columns. The rows which don't exist are skipped, e.g: they have been deleted.
+	UpdateValues(table string, keys, updates []string, rows int) string
+	// UpdateJoin updates the table by the rows of the joined table matching the condition, the sets are "column=value"
+	// of the columns of the table, e.g: UpdateJoin("t", "l", "s_table s", "l.id=s.id", "`minted`=s.minted").
+	UpdateJoin(table, alias, join, on string, sets ...string) string
+	LimitOffset(limit, offset int64) string
+	// Returning is appended to the insert to get the ids of the inserted or overwritten rows if LastInsertId doesn't return them.
+	Returning(column string) string
+}
+
+var (
+	MySQL    Dialect = &mysqlDialect{}
+	Postgres Dialect = &postgresDialect{}
+	SQLite   Dialect = &sqliteDialect{}
+)
+
+// DialectOf detects the dialect by the driver of the db, MySQL is the default.
+func DialectOf(db *sql.DB) Dialect {
+	driver := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(driver, "pq.") || strings.Contains(driver, "stdlib."):
+		return Postgres
+	case strings.Contains(driver, "sqlite"):
+		return SQLite
+	}
+	return MySQL
+}
+
+// selectRows: rows selects of n placeholders joined by union all, the columns of the first one are aliased if columns is set.
+func selectRows(n, rows int, columns []string) string {
+	var selects []string
+	for i := 0; i < rows; i++ {
+		if i == 0 && len(columns) > 0 {
+			var aliases []string
+			for _, column := range columns {
+				aliases = append(aliases, "? as `"+column+"`")
+			}
+			selects = append(selects, "select "+strings.Join(aliases, ","))
+		} else {
+			selects = append(selects, "select "+strings.TrimSuffix(strings.Repeat("?,", n), ","))
+		}
+	}
+	return strings.Join(selects, " union all ")
+}
+
+// updateFromValues: the update from the rows for the dialects which take "update ... from". The rows are unioned after
+// the empty rows of the table, so that the types of the placeholders are those of the columns.
+func updateFromValues(table string, keys, updates []string, rows string) string {
+	var sets, conditions []string
+	for _, column := range updates {
+		sets = append(sets, fmt.Sprintf("`%s`=v.`%s`", column, column))
+	}
+	for _, column := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s.`%s`=v.`%s`", table, column, column))
+	}
+	return "update " + table + " set " + strings.Join(sets, ",") + " from (select " + quoteColumns(append(append([]string{}, keys...), updates...)) +
+		" from " + table + " where 1=0 union all " + rows + ") v where " + strings.Join(conditions, " and ")
+}
+
+// updateJoinFrom: the update join for the dialects which take "update ... from".
+func updateJoinFrom(table, alias, join, on string, sets []string) string {
+	return "update " + table + " as " + alias + " set " + strings.Join(sets, ",") + " from " + join + " where " + on
+}
+
+func quoteColumns(columns []string) string {
+	var quoted []string
+	for _, column := range columns {
+		quoted = append(quoted, "`"+column+"`")
+	}
+	return strings.Join(quoted, ",")
+}
+
+type mysqlDialect struct{}
+
+func (d *mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (d *mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (d *mysqlDialect) InsertIgnore(table string, columns []string, values string) string {
+	return "insert ignore into " + table + "(" + quoteColumns(columns) + ") values " + values
+}
+
+func (d *mysqlDialect) Upsert(table string, columns []string, values string, keys, updates []string, id string) string {
+	var clauses []string
+	for _, column := range updates {
+		clauses = append(clauses, fmt.Sprintf("`%s`=values(`%s`)", column, column))
+	}
+	if id != "" { // LastInsertId is the id of the overwritten row then
+		clauses = append(clauses, fmt.Sprintf("`%s`=last_insert_id(`%s`)", id, id))
+	} else if len(clauses) == 0 {
+		clauses = append(clauses, fmt.Sprintf("`%s`=`%s`", keys[0], keys[0]))
+	}
+	return "insert into " + table + "(" + quoteColumns(columns) + ") values " + values + " on duplicate key update " + strings.Join(clauses, ",")
+}
+
+func (d *mysqlDialect) UpdateValues(table string, keys, updates []string, rows int) string {
+	columns := append(append([]string{}, keys...), updates...)
+	var sets, conditions []string
+	for _, column := range updates {
+		sets = append(sets, fmt.Sprintf("%s.`%s`=v.`%s`", table, column, column))
+	}
+	for _, column := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s.`%s`=v.`%s`", table, column, column))
+	}
+	return "update " + table + " join (" + selectRows(len(columns), rows, columns) + ") v on " + strings.Join(conditions, " and ") + " set " + strings.Join(sets, ",")
+}
+
+func (d *mysqlDialect) UpdateJoin(table, alias, join, on string, sets ...string) string {
+	var clauses []string
+	for _, set := range sets {
+		clauses = append(clauses, alias+"."+set)
+	}
+	return "update " + table + " as " + alias + " join " + join + " on " + on + " set " + strings.Join(clauses, ",")
+}
+
+func (d *mysqlDialect) LimitOffset(limit, offset int64) string {
+	return fmt.Sprintf("limit %d offset %d", limit, offset)
+}
+
+func (d *mysqlDialect) Returning(column string) string {
+	return ""
+}
+
+type postgresDialect struct{}
+
+func (d *postgresDialect) Name() string {
+	return "postgres"
+}
+
+// Rebind: "`" quoting into '"' quoting and "?" placeholders into $1, $2..., the quoted strings are kept as they are.
+func (d *postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				if quote == '`' {
+					c = '"'
+				}
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '`':
+			quote, c = '`', '"'
+		case c == '?':
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func (d *postgresDialect) InsertIgnore(table string, columns []string, values string) string {
+	return "insert into " + table + "(" + quoteColumns(columns) + ") values " + values + " on conflict do nothing"
+}
+
+func (d *postgresDialect) Upsert(table string, columns []string, values string, keys, updates []string, id string) string {
+	var clauses []string
+	for _, column := range updates {
+		clauses = append(clauses, fmt.Sprintf("`%s`=excluded.`%s`", column, column))
+	}
+	if len(clauses) == 0 { // nothing to overwrite, but the conflicting row is still returned
+		clauses = append(clauses, fmt.Sprintf("`%s`=excluded.`%s`", keys[0], keys[0]))
+	}
+	return "insert into " + table + "(" + quoteColumns(columns) + ") values " + values + " on conflict (" + quoteColumns(keys) + ") do update set " + strings.Join(clauses, ",")
+}
+
+// UpdateValues: a values list would be typed text by itself, the selects are typed by the union.
+func (d *postgresDialect) UpdateValues(table string, keys, updates []string, rows int) string {
+	return updateFromValues(table, keys, updates, selectRows(len(keys)+len(updates), rows, nil))
+}
+
+func (d *postgresDialect) UpdateJoin(table, alias, join, on string, sets ...string) string {
+	return updateJoinFrom(table, alias, join, on, sets)
+}
+
+func (d *postgresDialect) LimitOffset(limit, offset int64) string {
+	return fmt.Sprintf("limit %d offset %d", limit, offset)
+}
+
+func (d *postgresDialect) Returning(column string) string {
+	return " returning `" + column + "`"
+}
+
+type sqliteDialect struct{}
+
+func (d *sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+// Rebind: SQLite takes both the "`" quoting and the "?" placeholders.
+func (d *sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (d *sqliteDialect) InsertIgnore(table string, columns []string, values string) string {
+	return "insert or ignore into " + table + "(" + quoteColumns(columns) + ") values " + values
+}
+
+func (d *sqliteDialect) Upsert(table string, columns []string, values string, keys, updates []string, id string) string {
+	var clauses []string
+	for _, column := range updates {
+		clauses = append(clauses, fmt.Sprintf("`%s`=excluded.`%s`", column, column))
+	}
+	if len(clauses) == 0 { // nothing to overwrite, but the conflicting row is still returned
+		clauses = append(clauses, fmt.Sprintf("`%s`=excluded.`%s`", keys[0], keys[0]))
+	}
+	return "insert into " + table + "(" + quoteColumns(columns) + ") values " + values + " on conflict (" + quoteColumns(keys) + ") do update set " + strings.Join(clauses, ",")
+}
+
+// UpdateValues: a values list, as the selects joined by union all are limited to 500 by SQLite.
+func (d *sqliteDialect) UpdateValues(table string, keys, updates []string, rows int) string {
+	n := len(keys) + len(updates)
+	return updateFromValues(table, keys, updates, "values "+strings.TrimSuffix(strings.Repeat("("+strings.TrimSuffix(strings.Repeat("?,", n), ",")+"),", rows), ","))
+}
+
+func (d *sqliteDialect) UpdateJoin(table, alias, join, on string, sets ...string) string {
+	return updateJoinFrom(table, alias, join, on, sets)
+}
+
+func (d *sqliteDialect) LimitOffset(limit, offset int64) string {
+	return fmt.Sprintf("limit %d offset %d", limit, offset)
+}
+
+// Returning: LastInsertId of SQLite is the last inserted row, and isn't changed by an overwritten row.
+func (d *sqliteDialect) Returning(column string) string {
+	return " returning `" + column + "`"
+}
@@ -0,0 +1,80 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PostgresRebind(t *testing.T) {
+	assert.Equal(t, `select "id" from btc_ord_tx where "txid"=$1 and "reason"='why?' and "key" in ($2,$3) order by id asc limit $4`,
+		Postgres.Rebind("select `id` from btc_ord_tx where `txid`=? and `reason`='why?' and `key` in (?,?) order by id asc limit ?"))
+	assert.Equal(t, `select 'it''s ?'`, Postgres.Rebind("select 'it''s ?'"))
+	assert.Equal(t, "select `id` from t where `a`=?", MySQL.Rebind("select `id` from t where `a`=?"))
+}
+
+type Dict struct {
+	meta string `table:"ord_dict"`
+	Id   int64  `json:"id"`
+	Key  string `json:"key"`
+}
+
+func Test_DialectInsert(t *testing.T) {
+	m := &Model{TablePrefix: "btc_"}
+	m.Bind(&Dict{}).BatchData(&Dict{Key: "a"})
+	assert.Equal(t, "insert ignore into btc_ord_dict(`key`) values (?)", (&sqlModel{Model: m, Dialect: MySQL}).buildInsertSQL())
+	assert.Equal(t, `insert into btc_ord_dict("key") values ($1) on conflict do nothing returning "id"`, (&sqlModel{Model: m, Dialect: Postgres}).buildInsertSQL())
+
+	assert.Equal(t, "insert into t(`a`,`b`) values (?,?) on duplicate key update `b`=values(`b`)", MySQL.Upsert("t", []string{"a", "b"}, "(?,?)", []string{"a"}, []string{"b"}, ""))
+	assert.Equal(t, `insert into t("a","b") values ($1,$2) on conflict ("a") do update set "b"=excluded."b"`, Postgres.Rebind(Postgres.Upsert("t", []string{"a", "b"}, "(?,?)", []string{"a"}, []string{"b"}, "id")))
+}
+
+func Test_DialectUpsert(t *testing.T) {
+	m := &Model{TablePrefix: "btc_"}
+	m.Bind(&Dict{}).BatchData(&Dict{Key: "a"}).Upsert("Key")
+	assert.Equal(t, "insert into btc_ord_dict(`key`) values (?) on duplicate key update `id`=last_insert_id(`id`)", (&sqlModel{Model: m, Dialect: MySQL}).buildInsertSQL())
+	assert.Equal(t, `insert into btc_ord_dict("key") values ($1) on conflict ("key") do update set "key"=excluded."key" returning "id"`, (&sqlModel{Model: m, Dialect: Postgres}).buildInsertSQL())
+
+}
+
+func Test_DialectBulkUpdate(t *testing.T) {
+	m := &Model{TablePrefix: "btc_"}
+	m.Bind(&Dict{}).BatchData(&Dict{Id: 1, Key: "a"}, &Dict{Id: 2, Key: "b"}).Overwrite("Key")
+	query, args := (&sqlModel{Model: m, Dialect: MySQL}).buildBulkUpdateSQL()
+	assert.Equal(t, "update btc_ord_dict join (select ? as `id`,? as `key` union all select ?,?) v on btc_ord_dict.`id`=v.`id` set btc_ord_dict.`key`=v.`key`", query)
+	assert.Equal(t, []any{int64(1), "a", int64(2), "b"}, args)
+	query, _ = (&sqlModel{Model: m, Dialect: Postgres}).buildBulkUpdateSQL()
+	assert.Equal(t, `update btc_ord_dict set "key"=v."key" from (select "id","key" from btc_ord_dict where 1=0 union all select $1,$2 union all select $3,$4) v where btc_ord_dict."id"=v."id"`, query)
+	query, _ = (&sqlModel{Model: m, Dialect: SQLite}).buildBulkUpdateSQL()
+	assert.Equal(t, "update btc_ord_dict set `key`=v.`key` from (select `id`,`key` from btc_ord_dict where 1=0 union all values (?,?),(?,?)) v where btc_ord_dict.`id`=v.`id`", query)
+}
+
+func Test_DialectUpdateJoin(t *testing.T) {
+	sets := []string{"`minted`=s.minted", "`block`=s.block"}
+	assert.Equal(t, "update btc_ord_tick as l join btc_ord_tick_shadow s on l.id=s.id set l.`minted`=s.minted,l.`block`=s.block",
+		MySQL.UpdateJoin("btc_ord_tick", "l", "btc_ord_tick_shadow s", "l.id=s.id", sets...))
+	assert.Equal(t, `update btc_ord_tick as l set "minted"=s.minted,"block"=s.block from btc_ord_tick_shadow s where l.id=s.id`,
+		Postgres.Rebind(Postgres.UpdateJoin("btc_ord_tick", "l", "btc_ord_tick_shadow s", "l.id=s.id", sets...)))
+}
+
+func Test_BuildSelectSQL(t *testing.T) {
+	m := &Model{TablePrefix: "btc_"}
+	m.Bind(&Dict{}).Where("Key", "a").Or(func(g *Model) { g.WhereGT("Id", 1).WhereLT("Id", 5) }, func(g *Model) { g.IsNull("Key") }).
+		Not(func(g *Model) { g.Like("Key", "b%") }).OrderByDesc("Id").Limit(10).Offset(20)
+	assert.Equal(t, "select `id`,`key` from btc_ord_dict where `key`=? and ((`id`>? and `id`<?) or (`key` is null)) and not (`key` like ?) order by `id` desc limit 10 offset 20",
+		(&sqlModel{Model: m, Dialect: MySQL}).buildSelectSQL())
+	assert.Equal(t, []any{"a", 1, 5, "b%"}, m.getArgs())
+
+	m = &Model{TablePrefix: "btc_"}
+	m.Bind(&Dict{}).As("d").Fields("Key", "count(*) as c").Join("ord_tick t", "t.name=d.key and t.max>?", 0).WhereIn("d.Id", 1, 2).
+		GroupBy("Key").Having("count(*)>?", 1).Extra("and `t`.`dec`<?", 18)
+	assert.Equal(t, `select "d"."key",count(*) as c from btc_ord_dict d join btc_ord_tick t on t.name=d.key and t.max>$1 where "d"."id" in ($2,$3) and "t"."dec"<$4 group by "d"."key" having count(*)>$5`,
+		(&sqlModel{Model: m, Dialect: Postgres}).buildSelectSQL())
+	assert.Equal(t, "select count(*) as c from (select 1 as g from btc_ord_dict d join btc_ord_tick t on t.name=d.key and t.max>? where `d`.`id` in (?,?) group by `d`.`key` having count(*)>?) t",
+		(&sqlModel{Model: m, Dialect: MySQL}).buildCountSQL())
+	assert.Equal(t, []any{0, 1, 2, 18, 1}, m.getArgs())
+
+	m = &Model{TablePrefix: "btc_"}
+	m.Table("ord_dict").Where("key", "a")
+	assert.Equal(t, "select * from btc_ord_dict where `key`=?", (&sqlModel{Model: m, Dialect: MySQL}).buildSelectSQL())
+}
@@ -0,0 +1,120 @@
+package orm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mappings of the struct types, by the type itself, the anonymous structs have no name.
+var mappings sync.Map
+
+// mapping of a struct to its table, it's read from the tags of the struct, e.g:
+//
+//	type Tx struct {
+//		meta     string `table:"ord_tx"`
+//		Id       int64  `db:"id,pk,autoincr" json:"id"`
+//		Position int    `db:"pos" json:"position"`
+//		Amount   string `json:"amt"`
+//		Extra    string `db:"-" json:"extra"`
+//	}
+//
+// The column of a field is the name in its db tag, or else the name in its json tag, e.g: Amount, so that the json shape of a
+// struct may differ from its columns. A field is not a column if its db tag is "-", or if neither tag names it.
+// The options of the db tag, e.g: `db:",pk"` or `db:"id,pk,autoincr"`, are:
+//   - pk: the column is the primary key or a part of it, the rows are bulk updated and paged by it.
+//   - autoincr: the column is generated by the database, Save skips it and returns it as lastInsertId.
+//   - readonly: the column is read but never written by Save or BulkUpdate, e.g: its default is set by the database.
+//
+// The id column is the pk and the autoincr column if no field is. The table is the table tag of the unexported meta field,
+// it's replaced by Table of the model if set.
+type mapping struct {
+	table    string
+	columns  []string                 // sorted
+	fields   map[string]*fieldMapping // by the name of the field
+	byColumn map[string]*fieldMapping
+	pk       []string
+	autoIncr string
+}
+
+type fieldMapping struct {
+	index    int
+	column   string
+	pk       bool
+	autoIncr bool
+	readOnly bool
+}
+
+// mappingOf the struct type t, which is read once and cached.
+func mappingOf(t reflect.Type) *mapping {
+	if v, ok := mappings.Load(t); ok {
+		return v.(*mapping)
+	}
+	mp := &mapping{fields: make(map[string]*fieldMapping), byColumn: make(map[string]*fieldMapping)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "meta" {
+			mp.table = f.Tag.Get("table")
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		dbTag, hasDbTag := f.Tag.Lookup("db")
+		if dbTag == "-" {
+			continue
+		}
+		options := strings.Split(dbTag, ",")
+		column := options[0]
+		if column == "" {
+			if jsonTag := strings.Split(f.Tag.Get("json"), ",")[0]; jsonTag != "-" {
+				column = jsonTag
+			}
+		}
+		if column == "" {
+			continue
+		}
+		fm := &fieldMapping{index: i, column: column}
+		if hasDbTag {
+			for _, option := range options[1:] {
+				switch strings.TrimSpace(option) {
+				case "pk":
+					fm.pk = true
+				case "autoincr":
+					fm.autoIncr = true
+				case "readonly":
+					fm.readOnly = true
+				}
+			}
+		}
+		mp.fields[f.Name] = fm
+		mp.byColumn[column] = fm
+		mp.columns = append(mp.columns, column)
+		if fm.pk {
+			mp.pk = append(mp.pk, column)
+		}
+		if fm.autoIncr {
+			mp.autoIncr = column
+		}
+	}
+	sort.Strings(mp.columns)
+	if id := mp.byColumn["id"]; id != nil {
+		if len(mp.pk) == 0 {
+			id.pk, mp.pk = true, []string{"id"}
+		}
+		if mp.autoIncr == "" {
+			id.autoIncr, mp.autoIncr = true, "id"
+		}
+	}
+	mappings.Store(t, mp)
+	return mp
+}
+
+// writable: whether the column is written by Save and BulkUpdate.
+func (mp *mapping) writable(column string) bool {
+	if fm := mp.byColumn[column]; fm != nil {
+		return !fm.autoIncr && !fm.readOnly
+	}
+	return true
+}
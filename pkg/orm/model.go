@@ -3,7 +3,6 @@ package orm
 import (
 	"encoding/json"
 	"fmt"
-	"libord/pkg/cmap"
 	"libord/pkg/conv"
 	"libord/pkg/maps"
 	"reflect"
@@ -11,26 +10,29 @@ import (
 	"strings"
 )
 
-var (
-	structTableNameCache cmap.ConcurrentMap
-	structFieldsCache    cmap.ConcurrentMap
-)
-
-func init() {
-	structTableNameCache = cmap.New()
-	structFieldsCache = cmap.New()
-}
-
 type Model struct {
 	TablePrefix     string
 	obj             any
 	table           string
+	alias           string
+	joins           []string
+	joinArgs        []any
 	whereConditions []string
+	whereArgs       []any
 	updateClauses   []string
+	groupBy         []string
+	having          []string
+	havingArgs      []any
+	orderBy         []string
+	limit           int64
+	offset          int64
 	extra           string
-	args            []any
+	extraArgs       []any
+	args            []any // the args of the update clauses or the data
 	columns         []string
 	data            []any // data for save, may be object or map
+	upsertKeys      []string
+	overwrites      []string // the columns overwritten by the upsert, all but the keys if empty
 }
 
 func (m *Model) Table(table string) *Model {
@@ -50,33 +52,12 @@ func (m *Model) Bind(obj any) *Model {
 		m.obj = reflect.New(reflect.TypeOf(m.obj)).Interface()
 		fallthrough
 	case reflect.Ptr:
+		mp := mappingOf(reflect.TypeOf(m.obj).Elem())
 		if m.table == "" {
-			structName := reflect.TypeOf(m.obj).Elem().Name()
-			tableName := structTableNameCache.GetValue(structName, nil)
-			if tableName == nil {
-				t := reflect.TypeOf(m.obj).Elem()
-				for i := 0; i < t.NumField(); i++ {
-					f := t.Field(i)
-					if strings.EqualFold(f.Name, "meta") {
-						if table := f.Tag.Get("table"); table != "" {
-							tableName = table
-							break
-						}
-					}
-				}
-				structTableNameCache.Set(structName, tableName)
-			}
-			m.table = tableName.(string)
+			m.table = mp.table
 		}
 		if len(m.columns) == 0 {
-			field2ColumnMap := structFieldsCache.GetValue(m.table, nil)
-			if field2ColumnMap == nil {
-				field2ColumnMap = m.getField2ColumnMap(m.obj)
-				structFieldsCache.Set(m.table, m.getField2ColumnMap(m.obj))
-			}
-			for _, v := range field2ColumnMap.(map[string]string) {
-				m.columns = append(m.columns, v)
-			}
+			m.columns = append(m.columns, mp.columns...)
 		}
 	}
 	sort.Strings(m.columns)
@@ -98,59 +79,90 @@ func (m *Model) BatchData(data ...any) *Model {
 	if len(data) == 0 {
 		return m
 	}
-	rt := reflect.TypeOf(data[0]).Elem()
+	columns := m.insertColumns()
 	for _, item := range data {
-		itemMap := make(map[string]any)
-		v := reflect.ValueOf(item)
-		if v.Kind() == reflect.Ptr || v.Kind() == reflect.Struct {
-			for i := 0; i < rt.NumField(); i++ {
-				field := rt.Field(i)
-				tag := field.Tag.Get("json")
-				if tag != "" && tag != "-" {
-					itemMap[strings.Split(tag, ",")[0]] = v.Elem().FieldByName(field.Name).Addr().Elem().Interface()
-				}
-			}
-		} else {
-			itemMap = conv.Map(item)
-		}
-		columns := m.getColumns()
+		itemMap := m.getItemMap(item)
 		for _, column := range columns {
-			if !strings.EqualFold(column, "id") { // auto increment, don't set
-				m.args = append(m.args, m.getFieldValue(itemMap[column]))
-			}
+			m.args = append(m.args, m.getFieldValue(itemMap[column]))
 		}
 	}
 	return m
 }
 
+// getItemMap: the values of the struct or map item by the columns.
+func (m *Model) getItemMap(item any) map[string]any {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	if v.Kind() != reflect.Struct {
+		return conv.Map(item)
+	}
+	mp := mappingOf(v.Type())
+	itemMap := make(map[string]any, len(mp.byColumn))
+	for column, fm := range mp.byColumn {
+		itemMap[column] = v.Field(fm.index).Interface()
+	}
+	return itemMap
+}
+
+// mapping of the bound struct, nil if a map or nothing is bound.
+func (m *Model) mapping() *mapping {
+	if m.obj == nil || reflect.ValueOf(m.obj).Kind() != reflect.Ptr {
+		return nil
+	}
+	return mappingOf(reflect.TypeOf(m.obj).Elem())
+}
+
+// insertColumns: the columns written by Save, the auto increment and the readonly columns are skipped.
+func (m *Model) insertColumns() (ret []string) {
+	mp := m.mapping()
+	for _, column := range m.getColumns() {
+		if (mp != nil && !mp.writable(column)) || (mp == nil && strings.EqualFold(column, "id")) {
+			continue
+		}
+		ret = append(ret, column)
+	}
+	return
+}
+
+// autoIncrColumn: the auto increment column among the columns, which Save returns, empty if none.
+func (m *Model) autoIncrColumn() string {
+	id := "id"
+	if mp := m.mapping(); mp != nil {
+		id = mp.autoIncr
+	}
+	for _, column := range m.getColumns() {
+		if id != "" && strings.EqualFold(column, id) {
+			return column
+		}
+	}
+	return ""
+}
+
+// pkColumns: the primary key of the bound struct, the id column if a map or nothing is bound.
+func (m *Model) pkColumns() []string {
+	if mp := m.mapping(); mp != nil {
+		return mp.pk
+	}
+	return []string{"id"}
+}
+
 func (m *Model) Where(field string, value any) *Model {
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s`=?", m.getColumn(field)))
-	m.args = append(m.args, m.getFieldValue(value))
-	return m
+	return m.where(field, "=", value)
 }
 
 func (m *Model) WhereLT(field string, value any) *Model {
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s`<?", m.getColumn(field)))
-	m.args = append(m.args, m.getFieldValue(value))
-	return m
+	return m.where(field, "<", value)
 }
 
 func (m *Model) WhereLTE(field string, value any) *Model {
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s`<=?", m.getColumn(field)))
-	m.args = append(m.args, m.getFieldValue(value))
-	return m
+	return m.where(field, "<=", value)
 }
 
 func (m *Model) WhereGT(field string, value any) *Model {
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s`>?", m.getColumn(field)))
-	m.args = append(m.args, m.getFieldValue(value))
-	return m
+	return m.where(field, ">", value)
 }
 
 func (m *Model) WhereGTE(field string, value any) *Model {
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s`>=?", m.getColumn(field)))
-	m.args = append(m.args, m.getFieldValue(value))
-	return m
+	return m.where(field, ">=", value)
 }
 
 func (m *Model) WhereIn(field string, values ...any) *Model {
@@ -158,27 +170,168 @@ func (m *Model) WhereIn(field string, values ...any) *Model {
 		return m
 	}
 	str := strings.Repeat("?,", len(values))
-	m.whereConditions = append(m.whereConditions, fmt.Sprintf("`%s` in ("+str[0:len(str)-1]+")", m.getColumn(field)))
+	m.whereConditions = append(m.whereConditions, m.quote(m.getColumn(field))+" in ("+str[0:len(str)-1]+")")
 	for _, v := range values {
-		m.args = append(m.args, m.getFieldValue(v))
+		m.whereArgs = append(m.whereArgs, m.getFieldValue(v))
 	}
 	return m
 }
 
+// Like matches the field by the pattern, e.g: Like("Tick", "or%"), the "%" and "_" in the pattern are wildcards.
+func (m *Model) Like(field string, pattern string) *Model {
+	return m.where(field, " like ", pattern)
+}
+
+func (m *Model) IsNull(field string) *Model {
+	m.whereConditions = append(m.whereConditions, m.quote(m.getColumn(field))+" is null")
+	return m
+}
+
+func (m *Model) IsNotNull(field string) *Model {
+	m.whereConditions = append(m.whereConditions, m.quote(m.getColumn(field))+" is not null")
+	return m
+}
+
+// Or adds one condition which is true if any group is, the conditions of a group are built on it by the Where methods and are all
+// true for it, e.g: Or(func(g *Model) { g.Where("Status", 1) }, func(g *Model) { g.Where("Status", 0).WhereGT("Block", 800000) })
+func (m *Model) Or(groups ...func(g *Model)) *Model {
+	var conditions []string
+	for _, fn := range groups {
+		if condition := m.group(fn); condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+	if len(conditions) > 0 {
+		m.whereConditions = append(m.whereConditions, "("+strings.Join(conditions, " or ")+")")
+	}
+	return m
+}
+
+// Not adds one condition which is true if any condition of the group is false.
+func (m *Model) Not(fn func(g *Model)) *Model {
+	if condition := m.group(fn); condition != "" {
+		m.whereConditions = append(m.whereConditions, "not "+condition)
+	}
+	return m
+}
+
+// group builds the conditions of fn on a model of the same table, their args are bound in place of the group.
+func (m *Model) group(fn func(g *Model)) string {
+	g := &Model{obj: m.obj, table: m.table, alias: m.alias}
+	fn(g)
+	if len(g.whereConditions) == 0 {
+		return ""
+	}
+	m.whereArgs = append(m.whereArgs, g.whereArgs...)
+	return "(" + strings.Join(g.whereConditions, " and ") + ")"
+}
+
+func (m *Model) where(field, op string, value any) *Model {
+	m.whereConditions = append(m.whereConditions, m.quote(m.getColumn(field))+op+"?")
+	m.whereArgs = append(m.whereArgs, m.getFieldValue(value))
+	return m
+}
+
+// As sets the alias of the table, which the fields of the joined tables are told from by, e.g: "x.Tick" or "t.name".
+// The fields of the table are qualified by the alias too, so it's set before the fields and the conditions.
+func (m *Model) As(alias string) *Model {
+	m.alias = alias
+	return m
+}
+
+// Join the table, the prefix of the model is added to it, e.g: As("x").Join("ord_tick t", "t.name=x.tick").
+// The on condition is raw SQL with "?" placeholders for the args.
+func (m *Model) Join(table, on string, args ...any) *Model {
+	return m.join("join", table, on, args...)
+}
+
+// LeftJoin the table as Join, the rows without a joined row are kept.
+func (m *Model) LeftJoin(table, on string, args ...any) *Model {
+	return m.join("left join", table, on, args...)
+}
+
+func (m *Model) join(kind, table, on string, args ...any) *Model {
+	m.joins = append(m.joins, kind+" "+m.TablePrefix+table+" on "+on)
+	m.joinArgs = append(m.joinArgs, args...)
+	return m
+}
+
+func (m *Model) GroupBy(fields ...string) *Model {
+	for _, field := range fields {
+		m.groupBy = append(m.groupBy, m.quote(m.getColumn(field)))
+	}
+	return m
+}
+
+// Having filters the groups by the condition, which is raw SQL with "?" placeholders for the args, e.g: Having("count(*)>?", 1).
+func (m *Model) Having(condition string, args ...any) *Model {
+	m.having = append(m.having, condition)
+	m.havingArgs = append(m.havingArgs, args...)
+	return m
+}
+
+func (m *Model) OrderBy(field string) *Model {
+	m.orderBy = append(m.orderBy, m.quote(m.getColumn(field))+" asc")
+	return m
+}
+
+func (m *Model) OrderByDesc(field string) *Model {
+	m.orderBy = append(m.orderBy, m.quote(m.getColumn(field))+" desc")
+	return m
+}
+
+func (m *Model) Limit(limit int64) *Model {
+	m.limit = limit
+	return m
+}
+
+// Offset skips the rows before the limit, it's ignored without a limit.
+func (m *Model) Offset(offset int64) *Model {
+	m.offset = offset
+	return m
+}
+
 func (m *Model) Update(field string, value any) *Model {
 	m.updateClauses = append(m.updateClauses, fmt.Sprintf("`%s`=?", m.getColumn(field)))
 	m.args = append(m.args, m.getFieldValue(value))
 	return m
 }
 
+// Upsert saves the data in upsert mode: a row conflicting with the unique key of the fields is overwritten instead of
+// being ignored, and the id of the affected row is returned by Save as lastInsertId.
+func (m *Model) Upsert(keys ...string) *Model {
+	for _, key := range keys {
+		m.upsertKeys = append(m.upsertKeys, m.getColumn(key))
+	}
+	return m
+}
+
+// Overwrite the fields of the conflicting row by the upsert, the other fields are kept. The readonly fields are never overwritten.
+func (m *Model) Overwrite(fields ...string) *Model {
+	mp := m.mapping()
+	for _, field := range fields {
+		if column := m.getColumn(field); mp == nil || mp.writable(column) {
+			m.overwrites = append(m.overwrites, column)
+		}
+	}
+	return m
+}
+
+// Extra is raw SQL appended to the where conditions of the statement, before the grouping, the order and the limit, or the whole
+// query if the model isn't bound to a table.
 func (m *Model) Extra(extra string, args ...any) *Model {
 	m.extra += extra
-	m.args = append(m.args, args...)
+	m.extraArgs = append(m.extraArgs, args...)
 	return m
 }
 
+// getArgs: the args in the order of their clauses in the statements.
 func (m *Model) getArgs() []any {
-	return m.args
+	var args []any
+	for _, part := range [][]any{m.args, m.joinArgs, m.whereArgs, m.extraArgs, m.havingArgs} {
+		args = append(args, part...)
+	}
+	return args
 }
 
 func (m *Model) getColumns() []string {
@@ -186,38 +339,45 @@ func (m *Model) getColumns() []string {
 }
 
 func (m *Model) getColumn(field string) string {
-	if m.obj == nil || reflect.ValueOf(m.obj).Kind() == reflect.Map {
-		return field
+	if alias, name, ok := strings.Cut(field, "."); ok {
+		if alias == m.alias { // the joined tables aren't bound, their fields are columns
+			name = m.getColumn(name)
+		}
+		return alias + "." + name
 	}
-	field2ColumnMap, _ := structFieldsCache.Get(m.table)
-	if v, ok := field2ColumnMap.(map[string]string)[field]; ok {
-		return v
+	if mp := m.mapping(); mp != nil {
+		if fm := mp.fields[field]; fm != nil {
+			return fm.column
+		}
 	}
 	return field
 }
 
-func (m *Model) convert(item map[string]any) any {
-	if m.obj == nil || reflect.ValueOf(m.obj).Kind() == reflect.Map {
-		return item
+// quote the column, which is qualified by the alias of the table if it has one. Expressions, e.g: count(*), are kept as they are.
+func (m *Model) quote(column string) string {
+	if strings.ContainsAny(column, "(` *") {
+		return column
+	}
+	if alias, name, ok := strings.Cut(column, "."); ok {
+		return "`" + alias + "`.`" + name + "`"
+	} else if m.alias != "" {
+		return "`" + m.alias + "`.`" + column + "`"
 	}
-	ret := reflect.New(reflect.TypeOf(m.obj).Elem()).Interface()
-	conv.StructLoose(item, ret)
-	return ret
+	return "`" + column + "`"
 }
 
-func (m *Model) getField2ColumnMap(obj any) map[string]string {
-	field2ColumnMap := make(map[string]string)
-	t := reflect.TypeOf(obj).Elem()
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		tag := f.Tag.Get("json")
-		if tag == "" || tag == "-" {
-			continue
+func (m *Model) convert(item map[string]any) any {
+	mp := m.mapping()
+	if mp == nil {
+		return item
+	}
+	ret := reflect.New(reflect.TypeOf(m.obj).Elem())
+	for column, value := range item {
+		if fm := mp.byColumn[column]; fm != nil {
+			conv.SetFieldValue(value, ret.Elem().Field(fm.index))
 		}
-		split := strings.Split(tag, ",")
-		field2ColumnMap[f.Name] = split[0]
 	}
-	return field2ColumnMap
+	return ret.Interface()
 }
 
 func (m *Model) getFieldValue(v any) any {
@@ -236,10 +396,17 @@ func (m *Model) getFieldValue(v any) any {
 func (m *Model) clean() {
 	m.table = ""
 	m.obj = nil
-	m.whereConditions = []string{}
+	m.alias = ""
+	m.joins, m.joinArgs = nil, nil
+	m.whereConditions, m.whereArgs = []string{}, nil
 	m.updateClauses = []string{}
+	m.groupBy, m.having, m.havingArgs = nil, nil, nil
+	m.orderBy, m.limit, m.offset = nil, 0, 0
 	m.extra = ""
+	m.extraArgs = nil
 	m.args = []any{}
 	m.columns = []string{}
 	m.data = []any{}
+	m.upsertKeys = nil
+	m.overwrites = nil
 }
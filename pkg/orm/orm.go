@@ -1,32 +1,82 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"libord/pkg/conv"
+	"libord/pkg/slice"
 	"reflect"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 type Orm struct {
-	Db *sql.DB
+	Db      *sql.DB
+	Tx      *sql.Tx         // the statements run in it if set, e.g: to write several models at once, Db is still needed for the dialect
+	Dialect Dialect         // detected from the driver of Db if nil
+	Ctx     context.Context // the statements are cancelled with it, e.g: on shutdown, context.Background() if nil
+	Timeout time.Duration   // of every call if not zero, e.g: a Find, a whole BulkUpdate, or an Each with the reading of its rows and its callbacks
+}
+
+// WithContext: a copy of the orm whose statements are cancelled with ctx.
+func (o *Orm) WithContext(ctx context.Context) *Orm {
+	c := *o
+	c.Ctx = ctx
+	return &c
+}
+
+// context of a call, it's cancelled once the call is done.
+func (o *Orm) context() (context.Context, context.CancelFunc) {
+	ctx := o.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if o.Timeout > 0 {
+		return context.WithTimeout(ctx, o.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// conn is satisfied by both *sql.DB and *sql.Tx.
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn: the Tx of the orm if set, or else its Db.
+func (o *Orm) conn() conn {
+	if o.Tx != nil {
+		return o.Tx
+	}
+	return o.Db
+}
+
+func (o *Orm) sqlModel(m *Model) *sqlModel {
+	if o.Dialect == nil {
+		o.Dialect = DialectOf(o.Db)
+	}
+	return &sqlModel{Model: m, Dialect: o.Dialect}
 }
 
 func (o *Orm) Find(m *Model) (ret []any, errRet error) {
 	defer m.clean()
-	rows, err := o.Db.Query((&sqlModel{Model: m}).buildSelectSQL(), m.getArgs()...)
+	ctx, cancel := o.context()
+	defer cancel()
+	rows, err := o.conn().QueryContext(ctx, o.sqlModel(m).buildSelectSQL(), m.getArgs()...)
 	if err != nil {
 		errRet = err
 		return
 	}
 	defer rows.Close()
 
+	columns, err3 := rows.Columns()
+	if err3 != nil {
+		errRet = err3
+		return
+	}
 	for rows.Next() {
-		columns, err3 := rows.Columns()
-		if err3 != nil {
-			errRet = err3
-			return
-		}
 		columnsMp := make(map[string]any, len(columns))
 		refs := make([]any, 0, len(columns))
 		for _, col := range columns {
@@ -52,7 +102,13 @@ func (o *Orm) Find(m *Model) (ret []any, errRet error) {
 
 func (o *Orm) Save(m *Model) (affected, lastInsertId int64, errRet error) {
 	defer m.clean()
-	result, err := o.Db.Exec((&sqlModel{Model: m}).buildInsertSQL(), m.getArgs()...)
+	_sqlModel := o.sqlModel(m)
+	if id := m.autoIncrColumn(); id != "" && _sqlModel.Dialect.Returning(id) != "" {
+		return o.saveReturning(_sqlModel)
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+	result, err := o.conn().ExecContext(ctx, _sqlModel.buildInsertSQL(), m.getArgs()...)
 	if err != nil {
 		errRet = err
 	} else {
@@ -62,9 +118,35 @@ func (o *Orm) Save(m *Model) (affected, lastInsertId int64, errRet error) {
 	return
 }
 
+// saveReturning: save with the ids of the inserted rows returned, lastInsertId is the first one as LastInsertId of MySQL.
+func (o *Orm) saveReturning(m *sqlModel) (affected, lastInsertId int64, errRet error) {
+	ctx, cancel := o.context()
+	defer cancel()
+	rows, err := o.conn().QueryContext(ctx, m.buildInsertSQL(), m.Model.getArgs()...)
+	if err != nil {
+		errRet = err
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if errRet = rows.Scan(&id); errRet != nil {
+			return
+		}
+		if affected == 0 {
+			lastInsertId = id
+		}
+		affected++
+	}
+	errRet = rows.Err()
+	return
+}
+
 func (o *Orm) Update(m *Model) (affected int64, errRet error) {
 	defer m.clean()
-	result, err := o.Db.Exec((&sqlModel{Model: m}).buildUpdateSQL(), m.getArgs()...)
+	ctx, cancel := o.context()
+	defer cancel()
+	result, err := o.conn().ExecContext(ctx, o.sqlModel(m).buildUpdateSQL(), m.getArgs()...)
 	if err != nil {
 		errRet = err
 	} else {
@@ -73,9 +155,54 @@ func (o *Orm) Update(m *Model) (affected int64, errRet error) {
 	return
 }
 
+// BulkUpdate writes the overwritten fields of the rows in the data by their primary keys, e.g:
+// BulkUpdate(m.Bind(&Tx{}).BatchData(txs...).Overwrite("Status", "Reason"), 500, true).
+// The rows are sent in statements of size rows at most, all in one transaction if inTx is true.
+// The rows which don't exist are skipped, they are never inserted.
+func (o *Orm) BulkUpdate(m *Model, size int, inTx bool) (errRet error) {
+	defer m.clean()
+	if len(m.data) == 0 || len(m.overwrites) == 0 {
+		return
+	}
+	if size <= 0 {
+		size = len(m.data)
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+	// The statements run in the Tx of the orm if set, it's committed by its owner.
+	var tx *sql.Tx
+	if inTx && o.Tx == nil {
+		if tx, errRet = o.Db.BeginTx(ctx, nil); errRet != nil {
+			return
+		}
+	}
+	data := m.data
+	for parti := range slice.Partition(len(data), size) {
+		m.data = data[parti.Low:parti.High]
+		query, args := o.sqlModel(m).buildBulkUpdateSQL()
+		if tx != nil {
+			_, errRet = tx.ExecContext(ctx, query, args...)
+		} else {
+			_, errRet = o.conn().ExecContext(ctx, query, args...)
+		}
+		if errRet != nil {
+			if tx != nil {
+				_ = tx.Rollback()
+			}
+			return
+		}
+	}
+	if tx != nil {
+		errRet = tx.Commit()
+	}
+	return
+}
+
 func (o *Orm) Delete(m *Model) (affected int64, errRet error) {
 	defer m.clean()
-	result, err := o.Db.Exec((&sqlModel{Model: m}).buildDeleteSQL(), m.getArgs()...)
+	ctx, cancel := o.context()
+	defer cancel()
+	result, err := o.conn().ExecContext(ctx, o.sqlModel(m).buildDeleteSQL(), m.getArgs()...)
 	if err != nil {
 		errRet = err
 	} else {
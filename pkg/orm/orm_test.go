@@ -1,15 +1,26 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"libord/pkg/conv"
+	"path/filepath"
 	"testing"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
+// openTestDb opens a SQLite database in a temp file with the user table.
+func openTestDb(t *testing.T) *sql.DB {
+	_db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	_, err = _db.Exec("create table user (bid integer primary key, name varchar(100), age int, address text, friends text, tasks text)")
+	assert.Nil(t, err)
+	return _db
+}
+
 type User struct {
 	meta    string   `table:"user"`
 	ID      int64    `json:"bid"`
@@ -36,9 +47,9 @@ type UserOne2One struct {
 }
 
 func Test_Orm_Struct(t *testing.T) {
-	_db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s", "root", "password", "localhost", "test"))
-	assert.Nil(t, err)
+	_db := openTestDb(t)
 	defer _db.Close()
+	var err error
 
 	o := &Orm{Db: _db}
 
@@ -103,9 +114,9 @@ func Test_Orm_Struct(t *testing.T) {
 }
 
 func Test_Orm_Struct_One2One(t *testing.T) {
-	_db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s", "root", "password", "localhost", "test"))
-	assert.Nil(t, err)
+	_db := openTestDb(t)
 	defer _db.Close()
+	var err error
 
 	o := &Orm{Db: _db}
 	m := &Model{}
@@ -158,9 +169,9 @@ func Test_Orm_Struct_One2One(t *testing.T) {
 }
 
 func Test_Orm_Map(t *testing.T) {
-	_db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s", "root", "password", "localhost", "test"))
-	assert.Nil(t, err)
+	_db := openTestDb(t)
 	defer _db.Close()
+	var err error
 
 	o := &Orm{Db: _db}
 
@@ -225,3 +236,366 @@ func Test_Orm_Map(t *testing.T) {
 	assert.Nil(t, err4)
 	assert.Equal(t, len(items), 0)
 }
+
+type Setting struct {
+	meta  string `table:"setting"`
+	Id    int64  `json:"id"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Note  string `json:"note"`
+}
+
+func Test_Orm_Upsert(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+
+	for _, key := range []string{"a", "b"} {
+		obj := &Setting{Key: key, Value: "1", Note: "first"}
+		_, _, err = o.Save(m.Bind(obj).BatchData(obj))
+		assert.Nil(t, err)
+	}
+
+	// insert ignore by default
+	obj := &Setting{Key: "b", Value: "2", Note: "second"}
+	affected, _, err := o.Save(m.Bind(obj).BatchData(obj))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), affected)
+
+	_, id, err := o.Save(m.Bind(obj).BatchData(obj).Upsert("Key").Overwrite("Value"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), id)
+	item, err := o.One(m.Bind(obj).Where("Key", "b"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", item.(*Setting).Value)
+	assert.Equal(t, "first", item.(*Setting).Note)
+
+	// all the columns but the keys are overwritten by default
+	_, id, err = o.Save(m.Bind(obj).BatchData(obj).Upsert("Key"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), id)
+	item, err = o.One(m.Bind(obj).Where("Key", "b"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", item.(*Setting).Note)
+
+	obj = &Setting{Key: "c", Value: "3"}
+	_, id, err = o.Save(m.Bind(obj).BatchData(obj).Upsert("Key"))
+	assert.Nil(t, err)
+	item, err = o.One(m.Bind(obj).Where("Key", "c"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, id, item.(*Setting).Id)
+}
+
+func Test_Orm_BulkUpdate(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+
+	var settings []any
+	for i := 0; i < 5; i++ {
+		settings = append(settings, &Setting{Key: "k" + conv.String(i), Value: "v" + conv.String(i), Note: "n" + conv.String(i)})
+	}
+	_, _, err = o.Save(m.Bind(&Setting{}).BatchData(settings...))
+	assert.Nil(t, err)
+
+	items, err := o.Find(m.Bind(&Setting{}).Extra("order by id asc"))
+	assert.Nil(t, err)
+	for _, item := range items {
+		item.(*Setting).Value = "changed_" + item.(*Setting).Key
+		item.(*Setting).Note = "not written"
+	}
+	for _, inTx := range []bool{false, true} {
+		assert.Nil(t, o.BulkUpdate(m.Bind(&Setting{}).BatchData(items...).Overwrite("Value"), 2, inTx))
+		items2, err := o.Find(m.Bind(&Setting{}).Extra("order by id asc"))
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(items2))
+		for i, item := range items2 {
+			assert.Equal(t, "changed_k"+conv.String(i), item.(*Setting).Value)
+			assert.Equal(t, "n"+conv.String(i), item.(*Setting).Note)
+		}
+	}
+
+	// A deleted row is not brought back.
+	_, err = o.Delete(m.Bind(&Setting{}).Where("Key", "k0"))
+	assert.Nil(t, err)
+	assert.Nil(t, o.BulkUpdate(m.Bind(&Setting{}).BatchData(items...).Overwrite("Value"), 0, false))
+	count, err := Count(o, m.Bind(&Setting{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5-1), count)
+}
+
+func Test_Orm_Each(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+
+	var settings []any
+	for i := 0; i < 10; i++ {
+		note := "even"
+		if i%2 == 1 {
+			note = "odd"
+		}
+		settings = append(settings, &Setting{Key: "k" + conv.String(i), Value: conv.String(i), Note: note})
+	}
+	_, _, err = o.Save(m.Bind(&Setting{}).BatchData(settings...))
+	assert.Nil(t, err)
+
+	var keys []string
+	err = o.EachPage(m.Bind(&Setting{}).Where("Note", "even").Extra("and `value`<>?", "4"), 2, func(item any) error {
+		keys = append(keys, item.(*Setting).Key)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k0", "k2", "k6", "k8"}, keys)
+
+	keys = nil
+	err = o.EachPage(m.Bind(&Setting{}), 3, func(item any) error {
+		if keys = append(keys, item.(*Setting).Key); len(keys) == 4 {
+			return Break
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k0", "k1", "k2", "k3"}, keys)
+
+	// the pages are not paged again by an offset, nor by a key which isn't an integer
+	assert.NotNil(t, o.EachPage(m.Bind(&Setting{}).Offset(2), 3, func(item any) error { return nil }))
+	type SettingKey struct {
+		meta string `table:"setting"`
+		Key  string `db:"key,pk"`
+	}
+	assert.NotNil(t, o.EachPage(m.Bind(&SettingKey{}), 3, func(item any) error { return nil }))
+
+	// the integer columns are int64 and the others are strings
+	var rows []map[string]any
+	err = o.Each(m.Extra("select id,`key`,note from setting where value>=? order by id desc", "8"), func(item any) error {
+		rows = append(rows, item.(map[string]any))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]any{{"id": int64(10), "key": "k9", "note": "odd"}, {"id": int64(9), "key": "k8", "note": "even"}}, rows)
+}
+
+func Test_Orm_Typed(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+
+	var settings []any
+	for i := 0; i < 5; i++ {
+		settings = append(settings, &Setting{Key: "k" + conv.String(i), Value: conv.String(i * 10), Note: "n"})
+	}
+	_, _, err = o.Save(m.Bind(&Setting{}).BatchData(settings...))
+	assert.Nil(t, err)
+
+	found, err := Find[*Setting](o, m.Bind(&Setting{}).WhereGT("Id", 3).Extra("order by id asc"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "k3", found[0].Key)
+
+	first, err := First[*Setting](o, m.Bind(&Setting{}).Where("Key", "k2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "20", first.Value)
+	first, err = First[*Setting](o, m.Bind(&Setting{}).Where("Key", "none"))
+	assert.Nil(t, err)
+	assert.Nil(t, first)
+
+	_, err = Find[*User](o, m.Bind(&Setting{}))
+	assert.NotNil(t, err)
+
+	count, err := Count(o, m.Bind(&Setting{}).Where("Note", "n").WhereGTE("Id", 2).Extra("order by id asc limit ?", 1))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+
+	ids, err := Pluck[int64](o, m.Bind(&Setting{}).WhereLTE("Id", 3).Extra("order by id desc"), "Id")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3, 2, 1}, ids)
+	values, err := Pluck[string](o, m.Bind(&Setting{}).Where("Key", "k1"), "Value")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10"}, values)
+}
+
+func Test_Orm_Query(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+
+	var settings []any
+	for i := 0; i < 6; i++ {
+		settings = append(settings, &Setting{Key: "k" + conv.String(i), Value: conv.String(i % 3), Note: "n" + conv.String(i%2)})
+	}
+	_, _, err = o.Save(m.Bind(&Setting{}).BatchData(settings...))
+	assert.Nil(t, err)
+	_, err = _db.Exec("update setting set note=null where `key`='k5'")
+	assert.Nil(t, err)
+
+	keys, err := Pluck[string](o, m.Bind(&Setting{}).Or(func(g *Model) { g.Where("Value", "0") }, func(g *Model) { g.Like("Key", "k%").IsNull("Note") }).
+		OrderByDesc("Id"), "Key")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k5", "k3", "k0"}, keys)
+
+	keys, err = Pluck[string](o, m.Bind(&Setting{}).Not(func(g *Model) { g.Where("Note", "n0") }).IsNotNull("Note").OrderBy("Id").Limit(1).Offset(1), "Key")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k3"}, keys)
+
+	// the groups of the values with more than one note
+	var rows []map[string]any
+	err = o.Each(m.Table("setting").Fields("value", "count(*) as c").IsNotNull("note").GroupBy("value").Having("count(*)>?", 1).OrderBy("value"), func(item any) error {
+		rows = append(rows, item.(map[string]any))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]any{{"value": "0", "c": int64(2)}, {"value": "1", "c": int64(2)}}, rows)
+	count, err := Count(o, m.Table("setting").GroupBy("value"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// the settings of the users of the same id
+	_, _, err = o.Save(m.Bind(&User{}).BatchData(&User{ID: 2, Name: "bob"}, &User{ID: 4, Name: "tom"}))
+	assert.Nil(t, err)
+	found, err := Find[*Setting](o, m.Bind(&Setting{}).As("s").Join("user u", "u.bid=s.id and u.name<>?", "tom").OrderBy("Id"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, "k1", found[0].Key)
+}
+
+func Test_Orm_Context(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o := (&Orm{Db: _db}).WithContext(ctx)
+	m := &Model{}
+	_, err := o.Find(m.Bind(&User{}))
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = o.Save(m.Bind(&User{}).BatchData(&User{ID: 1, Name: "bob"}))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	o = &Orm{Db: _db, Timeout: time.Minute}
+	_, _, err = o.Save(m.Bind(&User{}).BatchData(&User{ID: 1, Name: "bob"}))
+	assert.Nil(t, err)
+	count, err := Count(o, m.Bind(&User{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+// Note is read and written by its db tags, its json shape differs from its columns. Its Meta field is a column, not the table.
+type Note struct {
+	meta    string `table:"note"`
+	Key     int64  `db:"nid,pk,autoincr" json:"id"`
+	Title   string `db:"title" json:"name"`
+	Body    string `json:"body"`
+	Meta    string `db:"meta" json:"meta"`
+	Created string `db:"created,readonly" json:"created"`
+	Draft   string `db:"-" json:"draft"`
+}
+
+func Test_Orm_Tags(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_, err := _db.Exec("create table note (nid integer primary key autoincrement, title text, body text, meta text, created text default 'now')")
+	assert.Nil(t, err)
+
+	o := &Orm{Db: _db}
+	m := &Model{}
+	assert.Equal(t, []string{"body", "created", "meta", "nid", "title"}, m.Bind(&Note{}).getColumns())
+	assert.Equal(t, []string{"body", "meta", "title"}, m.insertColumns())
+	m.clean()
+
+	for i := 0; i < 3; i++ {
+		note := &Note{Title: "t" + conv.String(i), Body: "b", Meta: "text/plain", Created: "never", Draft: "d"}
+		_, id, err := o.Save(m.Bind(note).BatchData(note))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(i+1), id)
+	}
+	note, err := First[*Note](o, m.Bind(&Note{}).Where("Title", "t1"))
+	assert.Nil(t, err)
+	assert.Equal(t, &Note{Key: 2, Title: "t1", Body: "b", Meta: "text/plain", Created: "now"}, note)
+	assert.Equal(t, `{"id":2,"name":"t1","body":"b","meta":"text/plain","created":"now","draft":""}`, conv.String(note))
+
+	note.Title, note.Created = "changed", "never"
+	assert.Nil(t, o.BulkUpdate(m.Bind(&Note{}).BatchData(note).Overwrite("Title", "Created"), 0, false))
+	var notes []*Note
+	assert.Nil(t, o.EachPage(m.Bind(&Note{}), 2, func(item any) error {
+		notes = append(notes, item.(*Note))
+		return nil
+	}))
+	assert.Equal(t, 3, len(notes))
+	assert.Equal(t, "changed", notes[1].Title)
+	assert.Equal(t, "now", notes[1].Created)
+
+	// The anonymous structs have no name, they're mapped by their own tags.
+	type titleRow = struct {
+		meta  string `table:"note"`
+		Id    int64  `db:"nid"`
+		Title string `db:"title"`
+	}
+	type bodyRow = struct {
+		meta string `table:"note"`
+		Id   int64  `db:"nid"`
+		Body string `db:"body"`
+	}
+	titles, err := Find[*titleRow](o, m.Bind(&titleRow{}).Where("Id", 1))
+	assert.Nil(t, err)
+	assert.Equal(t, []*titleRow{{Id: 1, Title: "t0"}}, titles)
+	bodies, err := Find[*bodyRow](o, m.Bind(&bodyRow{}).Where("Id", 1))
+	assert.Nil(t, err)
+	assert.Equal(t, []*bodyRow{{Id: 1, Body: "b"}}, bodies)
+}
+
+func Test_Orm_Tx(t *testing.T) {
+	_db := openTestDb(t)
+	defer _db.Close()
+	_db.SetMaxOpenConns(1)
+	_, err := _db.Exec("create table setting (id integer primary key autoincrement, `key` varchar(100) unique, value text, note text)")
+	assert.Nil(t, err)
+
+	for _, commit := range []bool{false, true} {
+		tx, err := _db.Begin()
+		assert.Nil(t, err)
+		o := &Orm{Db: _db, Tx: tx}
+		m := &Model{}
+		setting := &Setting{Key: "k", Value: "v1"}
+		_, setting.Id, err = o.Save(m.Bind(setting).BatchData(setting))
+		assert.Nil(t, err)
+		setting.Value = "v2"
+		assert.Nil(t, o.BulkUpdate(m.Bind(&Setting{}).BatchData(setting).Overwrite("Value"), 0, true))
+		// The rows written in the tx are read in it, the tx is left to its owner.
+		got, err := First[*Setting](o, m.Bind(&Setting{}).Where("Key", "k"))
+		assert.Nil(t, err)
+		assert.Equal(t, "v2", got.Value)
+		if commit {
+			assert.Nil(t, tx.Commit())
+		} else {
+			assert.Nil(t, tx.Rollback())
+		}
+		count, err := Count(&Orm{Db: _db}, m.Bind(&Setting{}))
+		assert.Nil(t, err)
+		if commit {
+			assert.Equal(t, int64(1), count)
+		} else {
+			assert.Equal(t, int64(0), count)
+		}
+	}
+}
@@ -1,39 +1,72 @@
 package orm
 
 import (
+	"slices"
 	"strings"
 )
 
 type sqlModel struct {
-	Model *Model
+	Model   *Model
+	Dialect Dialect
 }
 
 func (m *sqlModel) buildSelectSQL() string {
+	if m.Model.table == "" { // a raw query
+		return m.Dialect.Rebind(m.Model.extra)
+	}
 	var columns []string
 	for _, col := range m.Model.getColumns() {
-		if !strings.Contains(col, "(") { // don't add "`" for count(*)
-			col = "`" + col + "`"
-		}
-		columns = append(columns, col)
+		columns = append(columns, m.Model.quote(col))
 	}
-	if len(columns) > 0 {
-		str := "select " + strings.Join(columns, ",") + " from " + m.Model.TablePrefix + m.Model.table
-		if len(m.Model.whereConditions) > 0 {
-			str += " where " + strings.Join(m.Model.whereConditions, " and ")
-		}
-		return str + " " + m.Model.extra
+	if len(columns) == 0 {
+		columns = append(columns, "*")
+	}
+	// The extra may go on with the conditions, e.g: "and `value`<>?", so it's before the grouping, the order and the limit.
+	str := "select " + strings.Join(columns, ",") + m.buildFromSQL(m.Model.extra)
+	if len(m.Model.orderBy) > 0 {
+		str += " order by " + strings.Join(m.Model.orderBy, ",")
 	}
-	return m.Model.extra
+	if m.Model.limit > 0 {
+		str += " " + m.Dialect.LimitOffset(m.Model.limit, m.Model.offset)
+	}
+	return m.Dialect.Rebind(str)
 }
 
-func (m *sqlModel) buildInsertSQL() string {
-	var columns []string
-	for _, column := range m.Model.getColumns() {
-		if !strings.EqualFold(column, "id") {
-			columns = append(columns, "`"+column+"`")
-		}
+// buildCountSQL: count the rows, or the groups, the order, the limit and the extra are ignored. Its args are those of the select
+// but the extra ones.
+func (m *sqlModel) buildCountSQL() string {
+	if len(m.Model.groupBy) > 0 {
+		return m.Dialect.Rebind("select count(*) as c from (select 1 as g" + m.buildFromSQL("") + ") t")
+	}
+	return m.Dialect.Rebind("select count(*) as c" + m.buildFromSQL(""))
+}
+
+// buildFromSQL: the from, join, where, group by and having clauses of the select, the extra follows the where conditions.
+func (m *sqlModel) buildFromSQL(extra string) string {
+	str := " from " + m.Model.TablePrefix + m.Model.table
+	if m.Model.alias != "" {
+		str += " " + m.Model.alias
+	}
+	for _, join := range m.Model.joins {
+		str += " " + join
+	}
+	if len(m.Model.whereConditions) > 0 {
+		str += " where " + strings.Join(m.Model.whereConditions, " and ")
+	}
+	if extra != "" {
+		str += " " + extra
 	}
-	if len(columns) > 0 {
+	if len(m.Model.groupBy) > 0 {
+		str += " group by " + strings.Join(m.Model.groupBy, ",")
+	}
+	if len(m.Model.having) > 0 {
+		str += " having " + strings.Join(m.Model.having, " and ")
+	}
+	return str
+}
+
+func (m *sqlModel) buildInsertSQL() string {
+	if columns := m.Model.insertColumns(); len(columns) > 0 {
 		var valuesClauses []string
 		for range m.Model.data {
 			var clause []string
@@ -42,9 +75,48 @@ func (m *sqlModel) buildInsertSQL() string {
 			}
 			valuesClauses = append(valuesClauses, "("+strings.Join(clause, ",")+")")
 		}
-		return "insert ignore into " + m.Model.TablePrefix + m.Model.table + "(" + strings.Join(columns, ",") + ") values " + strings.Join(valuesClauses, ",")
+		table, values := m.Model.TablePrefix+m.Model.table, strings.Join(valuesClauses, ",")
+		id := m.Model.autoIncrColumn()
+		str := m.Dialect.InsertIgnore(table, columns, values)
+		if len(m.Model.upsertKeys) > 0 {
+			str = m.Dialect.Upsert(table, columns, values, m.Model.upsertKeys, m.overwrites(columns), id)
+		}
+		if id != "" {
+			str += m.Dialect.Returning(id)
+		}
+		return m.Dialect.Rebind(str)
+	}
+	return m.Dialect.Rebind(m.Model.extra)
+}
+
+// buildBulkUpdateSQL: update the overwritten columns of the rows in the data by their primary keys in a single statement,
+// while the values differ row by row.
+func (m *sqlModel) buildBulkUpdateSQL() (string, []any) {
+	keys := m.Model.pkColumns()
+	columns := append(append([]string{}, keys...), m.Model.overwrites...)
+	var args []any
+	for _, item := range m.Model.data {
+		itemMap := m.Model.getItemMap(item)
+		for _, column := range columns {
+			args = append(args, m.Model.getFieldValue(itemMap[column]))
+		}
+	}
+	str := m.Dialect.UpdateValues(m.Model.TablePrefix+m.Model.table, keys, m.Model.overwrites, len(m.Model.data))
+	return m.Dialect.Rebind(str), args
+}
+
+// overwrites: the columns overwritten by the upsert, all the columns but the keys by default.
+func (m *sqlModel) overwrites(columns []string) []string {
+	if len(m.Model.overwrites) > 0 {
+		return m.Model.overwrites
+	}
+	var ret []string
+	for _, column := range columns {
+		if !slices.Contains(m.Model.upsertKeys, column) {
+			ret = append(ret, column)
+		}
 	}
-	return m.Model.extra
+	return ret
 }
 
 func (m *sqlModel) buildUpdateSQL() string {
@@ -54,7 +126,7 @@ func (m *sqlModel) buildUpdateSQL() string {
 	} else { // don't use update without any condition, it's so danger
 		return ""
 	}
-	return str + " " + m.Model.extra
+	return m.Dialect.Rebind(str + " " + m.Model.extra)
 }
 
 func (m *sqlModel) buildDeleteSQL() string {
@@ -64,5 +136,5 @@ func (m *sqlModel) buildDeleteSQL() string {
 	} else { // don't use delete without any condition, it's so danger
 		return ""
 	}
-	return str + " " + m.Model.extra
+	return m.Dialect.Rebind(str + " " + m.Model.extra)
 }
@@ -0,0 +1,63 @@
+package orm
+
+import (
+	"fmt"
+	"libord/pkg/conv"
+	"reflect"
+)
+
+// Find queries the rows as T, which is the pointer of the bound struct or map[string]any, e.g:
+// txs, err := orm.Find[*models.Tx](_orm, _m.Bind(&models.Tx{}).Where("TxId", txid))
+func Find[T any](o *Orm, m *Model) (ret []T, err error) {
+	err = o.Each(m, func(item any) error {
+		v, ok := item.(T)
+		if !ok {
+			return typeError[T](item)
+		}
+		ret = append(ret, v)
+		return nil
+	})
+	return
+}
+
+// First queries the first row as T, it's the zero value of T, e.g: nil, if there is no row.
+func First[T any](o *Orm, m *Model) (ret T, err error) {
+	err = o.Each(m, func(item any) error {
+		v, ok := item.(T)
+		if !ok {
+			return typeError[T](item)
+		}
+		ret = v
+		return Break
+	})
+	return
+}
+
+// Count counts the rows matching the conditions of m, or the groups if it's grouped. The fields, the order, the limit and the extra of m are ignored.
+func Count(o *Orm, m *Model) (count int64, err error) {
+	defer m.clean()
+	m.extraArgs = nil
+	ctx, cancel := o.context()
+	defer cancel()
+	err = o.conn().QueryRowContext(ctx, o.sqlModel(m).buildCountSQL(), m.getArgs()...).Scan(&count)
+	return
+}
+
+// Pluck queries a single field of the rows as T, e.g: ids, err := orm.Pluck[int64](_orm, _m.Bind(&models.Tx{}).Where("Tick", tick), "Id")
+func Pluck[T any](o *Orm, m *Model, field string) (ret []T, err error) {
+	column := m.getColumn(field)
+	m.obj, m.columns = nil, []string{column}
+	err = o.Each(m, func(item any) error {
+		var v T
+		if value := item.(map[string]any)[column]; value != nil {
+			conv.SetFieldValue(value, reflect.ValueOf(&v).Elem())
+		}
+		ret = append(ret, v)
+		return nil
+	})
+	return
+}
+
+func typeError[T any](item any) error {
+	return fmt.Errorf("orm: the row is %T, not %v", item, reflect.TypeOf((*T)(nil)).Elem())
+}
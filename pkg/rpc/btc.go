@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"context"
 	"encoding/base64"
 	"libord/pkg/conv"
 	"libord/pkg/ghttp"
@@ -17,6 +18,22 @@ type Btc struct {
 	Url      string
 	User     string
 	Password string
+	Ctx      context.Context // the calls are cancelled with it, e.g: on shutdown, context.Background() if nil
+	Timeout  time.Duration   // of every try of a call, a minute if zero
+}
+
+// WithContext: a copy of the client whose calls are cancelled with ctx.
+func (r *Btc) WithContext(ctx context.Context) *Btc {
+	c := *r
+	c.Ctx = ctx
+	return &c
+}
+
+func (r *Btc) context() context.Context {
+	if r.Ctx == nil {
+		return context.Background()
+	}
+	return r.Ctx
 }
 
 func (r *Btc) GetBlockNumber() (result int64, errRet error) {
@@ -125,25 +142,35 @@ func (r *Btc) GetTransactionByHash(hash string) (result map[string]any, errRet e
 }
 
 func (r *Btc) Request(method string, params any) (ret map[string]any, errRet error) {
+	ctx := r.context()
 	for i := 0; i < 5; i++ { // retry 5 times
-		if result, err := r.doReq(method, params); err == nil {
+		if result, err := r.doReq(ctx, method, params); err == nil {
 			return result, nil
 		} else {
 			errRet = err
-			time.Sleep(time.Second)
+		}
+		select {
+		case <-ctx.Done(): // don't retry after the cancel
+			errRet = errors.Wrapf(ctx.Err(), "%s:%v", method, errRet)
+			return
+		case <-time.After(time.Second):
 		}
 	}
 	return
 }
 
-func (r *Btc) doReq(method string, params any) (ret map[string]any, errRet error) {
+func (r *Btc) doReq(ctx context.Context, method string, params any) (ret map[string]any, errRet error) {
 	if params == nil {
 		params = []any{}
 	}
 	id := "1"
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
 	req := &ghttp.Request{
 		Method:      http.MethodPost,
-		ReadTimeOut: time.Minute,
+		ReadTimeOut: timeout,
 		Url:         r.Url,
 		Body: conv.String(map[string]any{
 			"id":      id,
@@ -155,7 +182,7 @@ func (r *Btc) doReq(method string, params any) (ret map[string]any, errRet error
 	if r.User != "" && r.Password != "" {
 		req.Headers = map[string]string{"Content-Type": "application/json", "Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(r.User+":"+r.Password))}
 	}
-	if respBytes, httpStatusCode, err := req.DoReq(); err != nil {
+	if respBytes, httpStatusCode, err := req.DoReqContext(ctx); err != nil {
 		errRet = err
 	} else {
 		if httpStatusCode != http.StatusOK {
@@ -0,0 +1,33 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BtcCancel(t *testing.T) {
+	// A node which never answers, the calls wait for the timeout or the cancel.
+	release := make(chan struct{})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer node.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_btc := &Btc{Chain: "btc", Url: node.URL, Timeout: time.Hour}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := _btc.WithContext(ctx).GetBlockNumber()
+	assert.ErrorIs(t, err, context.Canceled)
+	// The call isn't retried after the cancel.
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
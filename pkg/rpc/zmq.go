@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+// Zmq subscribes the zmqpubhashblock and zmqpubrawtx notifications of the node.
+// It reconnects if the node goes away, the consumers are expected to keep polling meanwhile.
+type Zmq struct {
+	HashBlockEndpoint string             // e.g: tcp://127.0.0.1:28332, empty means no block notifications
+	RawTxEndpoint     string             // e.g: tcp://127.0.0.1:28333, empty means no mempool txs
+	OnTx              func(rawTx []byte) // called with every new mempool tx, rawtx isn't subscribed if it's nil
+	RetryInterval     time.Duration      // the wait before reconnecting, 10s by default
+
+	blocks chan struct{}
+	once   sync.Once
+}
+
+// Blocks returns the channel notified of new blocks, the notifications not received yet are merged into one
+// since the receiver is expected to catch up to the tip anyway.
+func (z *Zmq) Blocks() <-chan struct{} {
+	z.once.Do(func() {
+		z.blocks = make(chan struct{}, 1)
+	})
+	return z.blocks
+}
+
+// Run receives the notifications until stop is closed.
+func (z *Zmq) Run(stop <-chan struct{}) error {
+	z.Blocks()
+	retryInterval := z.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = 10 * time.Second
+	}
+	for {
+		err := z.subscribe(stop)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		log.Printf("[WARN] zmq subscription error:%+v, retry in %s", err, retryInterval)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (z *Zmq) subscribe(stop <-chan struct{}) (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+	// Cancelling the context interrupts the receiving.
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var endpoints []string
+	if z.HashBlockEndpoint != "" {
+		endpoints = append(endpoints, z.HashBlockEndpoint)
+		if err = sub.SetOption(zmq4.OptionSubscribe, "hashblock"); err != nil {
+			return
+		}
+	}
+	if z.RawTxEndpoint != "" && z.OnTx != nil {
+		if z.RawTxEndpoint != z.HashBlockEndpoint {
+			endpoints = append(endpoints, z.RawTxEndpoint)
+		}
+		if err = sub.SetOption(zmq4.OptionSubscribe, "rawtx"); err != nil {
+			return
+		}
+	}
+	if len(endpoints) == 0 {
+		err = errors.Errorf("no zmq endpoint")
+		return
+	}
+	for _, endpoint := range endpoints {
+		if err = sub.Dial(endpoint); err != nil {
+			return
+		}
+	}
+	log.Printf("subscribed zmq endpoints:%v", endpoints)
+
+	for {
+		msg, _err := sub.Recv()
+		if _err != nil {
+			err = _err
+			return
+		}
+		// The frames are the topic, the body and the sequence number.
+		if len(msg.Frames) < 2 {
+			continue
+		}
+		switch string(msg.Frames[0]) {
+		case "hashblock":
+			select {
+			case z.blocks <- struct{}{}:
+			default:
+			}
+		case "rawtx":
+			if z.OnTx != nil {
+				z.OnTx(msg.Frames[1])
+			}
+		}
+	}
+}
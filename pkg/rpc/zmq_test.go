@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPublisher: a local publisher standing in for the zmq endpoints of the node.
+func newPublisher(t *testing.T) (zmq4.Socket, string) {
+	pub := zmq4.NewPub(context.Background())
+	if err := pub.Listen("tcp://127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return pub, "tcp://" + pub.Addr().String()
+}
+
+func Test_ZmqBlocks(t *testing.T) {
+	pub, endpoint := newPublisher(t)
+	defer pub.Close()
+
+	txs := make(chan []byte, 10)
+	_zmq := &Zmq{HashBlockEndpoint: endpoint, RawTxEndpoint: endpoint, OnTx: func(rawTx []byte) {
+		txs <- rawTx
+	}}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- _zmq.Run(stop)
+	}()
+
+	// The messages published before the subscription is set up are lost, keep publishing until one arrives.
+	publish := func(topic string, body []byte, received func() bool) bool {
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, pub.Send(zmq4.NewMsgFrom([]byte(topic), body, []byte{0, 0, 0, 0})))
+			if received() {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, publish("hashblock", make([]byte, 32), func() bool {
+		select {
+		case <-_zmq.Blocks():
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}))
+	var rawTx []byte
+	assert.True(t, publish("rawtx", []byte{1, 2, 3}, func() bool {
+		select {
+		case rawTx = <-txs:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}))
+	assert.Equal(t, []byte{1, 2, 3}, rawTx)
+
+	close(stop)
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber not stopped")
+	}
+}
+
+func Test_ZmqUnreachable(t *testing.T) {
+	_zmq := &Zmq{HashBlockEndpoint: "tcp://127.0.0.1:1", RetryInterval: 10 * time.Millisecond}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- _zmq.Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber not stopped")
+	}
+}